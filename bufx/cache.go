@@ -18,10 +18,12 @@ type Entry[K comparable, V any] struct {
 }
 
 type SimpleCache[K comparable, V any] struct {
-	Size  int
-	mutex sync.RWMutex
-	store map[K]*Entry[K, V]
-	keys  []K
+	Size int
+	// OnEvict is called with the lock held for an entry dropped to make room
+	OnEvict func(key K, val V)
+	mutex   sync.RWMutex
+	store   map[K]*Entry[K, V]
+	keys    []K
 }
 
 func (it *SimpleCache[K, V]) Get(key K) (V, bool) {
@@ -44,7 +46,12 @@ func (it *SimpleCache[K, V]) Put(key K, val V) {
 	entry := it.store[key]
 	if entry == nil {
 		if it.Size > 0 && len(it.store)+1 > it.Size {
-			delete(it.store, it.keys[0])
+			if evicted, ok := it.store[it.keys[0]]; ok {
+				delete(it.store, evicted.Key)
+				if it.OnEvict != nil {
+					it.OnEvict(evicted.Key, evicted.Value)
+				}
+			}
 			it.keys = it.keys[1:]
 		}
 		entry = &Entry[K, V]{Key: key}
@@ -43,3 +43,15 @@ func TestSimpleCache_Put(t *testing.T) {
 		}(id)
 	}
 }
+
+func TestSimpleCache_OnEvict(t *testing.T) {
+	var evicted []int
+	cache := &SimpleCache[int, int]{Size: 2, OnEvict: func(key int, val int) {
+		evicted = append(evicted, key)
+	}}
+	cache.Put(0, 1)
+	cache.Put(1, 1)
+	cache.Put(2, 1)
+	assert.Equal(t, []int{0}, evicted)
+	assert.Equal(t, 2, cache.Len())
+}
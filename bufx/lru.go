@@ -6,7 +6,9 @@ import (
 )
 
 type LruCache[K comparable, V any] struct {
-	Size        int
+	Size int
+	// OnEvict is called with the lock held for an entry dropped to make room
+	OnEvict     func(key K, val V)
 	store       map[K]*datax.LinkedNode[Entry[K, V]]
 	first       *datax.LinkedNode[Entry[K, V]]
 	last        *datax.LinkedNode[Entry[K, V]]
@@ -49,6 +51,9 @@ func (it *LruCache[K, V]) asFirst(node *datax.LinkedNode[Entry[K, V]]) {
 func (it *LruCache[K, V]) removeLast() {
 	if it.last != nil {
 		delete(it.store, it.last.Item.Key)
+		if it.OnEvict != nil {
+			it.OnEvict(it.last.Item.Key, it.last.Item.Value)
+		}
 		if it.last.Pre != nil {
 			it.last = it.last.Pre
 			it.last.Next = nil
@@ -56,3 +56,16 @@ func TestLruCache_Get(t *testing.T) {
 	assert.Equal(t, false, ok)
 	assert.Equal(t, 0, val)
 }
+
+func TestLruCache_OnEvict(t *testing.T) {
+	var evicted []int
+	cache := &LruCache[int, int]{Size: 2, OnEvict: func(key int, val int) {
+		evicted = append(evicted, key)
+	}}
+	cache.Put(0, 1)
+	cache.Put(1, 1)
+	cache.Get(0)
+	cache.Put(2, 1)
+	cache.Put(2, 2)
+	assert.Equal(t, []int{1}, evicted)
+}
@@ -0,0 +1,225 @@
+package evalx
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// adapter gives a Context the Builtins as its methods and the DefaultCache
+// for its expressions
+type adapter struct{}
+
+func (adapter) MethodOf(ident string) (any, bool) {
+	return TopScope().MethodOf(ident)
+}
+
+func (adapter) CacheOf(text string) (ast.Expr, bool) {
+	return topCache.Get(text)
+}
+
+func (adapter) Cache(text string, expr ast.Expr) {
+	topCache.Put(text, expr)
+}
+
+// EnvContext resolves identifiers to environment variables
+type EnvContext struct {
+	adapter
+	vars map[string]string
+}
+
+// NewEnvContext takes the variables from environ, entries in the form
+// key=value, or os.Environ if there are none
+func NewEnvContext(environ ...string) *EnvContext {
+	if len(environ) < 1 {
+		environ = os.Environ()
+	}
+	it := &EnvContext{vars: map[string]string{}}
+	for _, item := range environ {
+		if key, val, ok := strings.Cut(item, "="); ok {
+			it.vars[key] = val
+		}
+	}
+	return it
+}
+
+func (it *EnvContext) ValueOf(ident string) (any, bool) {
+	val, ok := it.vars[ident]
+	return val, ok
+}
+
+// JSONContext resolves identifiers to the members of a JSON object, the
+// objects and arrays nested in it are reached by selectors and indexes
+type JSONContext struct {
+	adapter
+	doc map[string]any
+}
+
+func NewJSONContext(doc map[string]any) *JSONContext {
+	return &JSONContext{doc: doc}
+}
+
+// ParseJSON decodes an object into a JSONContext, keeping the integers as
+// int64 rather than float64
+func ParseJSON(data []byte) (*JSONContext, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return NewJSONContext(numbersOfJSON(doc).(map[string]any)), nil
+}
+
+func numbersOfJSON(val any) any {
+	switch tmp := val.(type) {
+	case json.Number:
+		if num, err := tmp.Int64(); err == nil {
+			return num
+		}
+		num, _ := tmp.Float64()
+		return num
+	case map[string]any:
+		for key, item := range tmp {
+			tmp[key] = numbersOfJSON(item)
+		}
+	case []any:
+		for i, item := range tmp {
+			tmp[i] = numbersOfJSON(item)
+		}
+	}
+	return val
+}
+
+func (it *JSONContext) ValueOf(ident string) (any, bool) {
+	val, ok := it.doc[ident]
+	return val, ok
+}
+
+// ValuesContext resolves identifiers to the first value of a key of
+// url.Values or http.Header, or all its values if Multi is set. The key is
+// matched as written, then as a canonical header key with _ standing for -,
+// then regardless of case.
+type ValuesContext struct {
+	adapter
+	values map[string][]string
+	Multi  bool
+}
+
+func NewValuesContext(values map[string][]string) *ValuesContext {
+	return &ValuesContext{values: values}
+}
+
+func (it *ValuesContext) ValueOf(ident string) (any, bool) {
+	list, ok := it.values[ident]
+	if !ok {
+		list, ok = it.values[textproto.CanonicalMIMEHeaderKey(strings.ReplaceAll(ident, "_", "-"))]
+	}
+	if !ok {
+		for key, item := range it.values {
+			if strings.EqualFold(strings.ReplaceAll(key, "-", "_"), ident) {
+				list, ok = item, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, false
+	} else if it.Multi {
+		return list, true
+	} else if len(list) < 1 {
+		return "", true
+	}
+	return list[0], true
+}
+
+type ShadowPolicy uint
+
+const (
+	// ShadowFirst resolves an identifier in the first context that has it
+	ShadowFirst ShadowPolicy = iota
+	// ShadowLast resolves an identifier in the last context that has it, so
+	// the later contexts override the earlier ones
+	ShadowLast
+	// ShadowNonNil resolves an identifier in the first context where it is
+	// not nil, or to nil if it is nil everywhere
+	ShadowNonNil
+)
+
+// ChainContext consults several contexts in order, expressions are cached
+// by the first of them. A Scope resolves the Builtins itself, so in a chain
+// it shadows the functions of the same name in the contexts after it.
+type ChainContext struct {
+	adapter
+	contexts []Context
+	policy   ShadowPolicy
+}
+
+func NewChainContext(contexts ...Context) *ChainContext {
+	return &ChainContext{contexts: contexts}
+}
+
+func (it *ChainContext) Shadow(policy ShadowPolicy) *ChainContext {
+	it.policy = policy
+	return it
+}
+
+// Append adds contexts to be consulted after the present ones
+func (it *ChainContext) Append(contexts ...Context) *ChainContext {
+	it.contexts = append(it.contexts, contexts...)
+	return it
+}
+
+func (it *ChainContext) lookup(find func(ctx Context) (any, bool)) (any, bool) {
+	var ret any
+	found := false
+	for _, ctx := range it.contexts {
+		val, ok := find(ctx)
+		if !ok {
+			continue
+		}
+		switch it.policy {
+		case ShadowFirst:
+			return val, true
+		case ShadowNonNil:
+			if val != nil {
+				return val, true
+			}
+		}
+		ret, found = val, true
+	}
+	return ret, found
+}
+
+func (it *ChainContext) ValueOf(ident string) (any, bool) {
+	return it.lookup(func(ctx Context) (any, bool) {
+		return ctx.ValueOf(ident)
+	})
+}
+
+func (it *ChainContext) MethodOf(ident string) (any, bool) {
+	if ret, ok := it.lookup(func(ctx Context) (any, bool) {
+		return ctx.MethodOf(ident)
+	}); ok {
+		return ret, true
+	}
+	return it.adapter.MethodOf(ident)
+}
+
+func (it *ChainContext) CacheOf(text string) (ast.Expr, bool) {
+	if len(it.contexts) > 0 {
+		return it.contexts[0].CacheOf(text)
+	}
+	return it.adapter.CacheOf(text)
+}
+
+func (it *ChainContext) Cache(text string, expr ast.Expr) {
+	if len(it.contexts) > 0 {
+		it.contexts[0].Cache(text, expr)
+	} else {
+		it.adapter.Cache(text, expr)
+	}
+}
@@ -0,0 +1,112 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestEnvContext(t *testing.T) {
+	ctx := NewEnvContext("APP_PORT=8080", "APP_NAME=demo", "EMPTY=")
+	cases := map[string]any{
+		"APP_NAME + ':' + APP_PORT": "demo:8080",
+		"int(APP_PORT) + 1":         int64(8081),
+		"EMPTY == ''":               true,
+		"MISSING ?? 'none'":         "none",
+	}
+	for text, expect := range cases {
+		ret, err := EvalWith(text, ctx, EvalOptions{})
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+	t.Setenv("EVALX_TEST", "on")
+	ret, err := Eval("EVALX_TEST", NewEnvContext())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "on", ret)
+}
+
+func TestJSONContext(t *testing.T) {
+	ctx, err := ParseJSON([]byte(`{"order": {"id": 7, "items": [{"price": 1.5, "qty": 2}, {"price": 3, "qty": 1}]}, "tags": ["a", "b"]}`))
+	assert.Equal(t, nil, err)
+	cases := map[string]any{
+		"order.id + 1":         int64(8),
+		"order.items[1].price": int64(3),
+		"sum(map(order.items, i -> i.price * i.qty))": 6.0,
+		"tags[len(tags) - 1]":                         "b",
+		"order?.customer?.name":                       nil,
+	}
+	for text, expect := range cases {
+		ret, err := EvalWith(text, ctx, EvalOptions{})
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+	_, err = ParseJSON([]byte(`[1, 2]`))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestValuesContext(t *testing.T) {
+	query := url.Values{"page": {"2"}, "tag": {"a", "b"}}
+	header := http.Header{}
+	header.Set("X-Request-Id", "abc")
+	header.Set("Content-Type", "text/plain")
+	cases := []struct {
+		text   string
+		ctx    Context
+		expect any
+	}{
+		{"int(page) * 10", NewValuesContext(query), int64(20)},
+		{"tag", NewValuesContext(query), "a"},
+		{"X_Request_Id", NewValuesContext(header), "abc"},
+		{"content_type", NewValuesContext(header), "text/plain"},
+		{"missing ?? 'none'", NewValuesContext(header), "none"},
+		{"len(tag)", &ValuesContext{values: query, Multi: true}, 2},
+	}
+	for _, item := range cases {
+		ret, err := EvalWith(item.text, item.ctx, EvalOptions{})
+		assert.Equal(t, nil, err, item.text)
+		assert.Equal(t, item.expect, ret, item.text)
+	}
+}
+
+func TestChainContext(t *testing.T) {
+	defaults := NewScope(map[string]any{"host": "localhost", "port": 80})
+	defaults.Bind("user", nil)
+	env := NewEnvContext("host=example.com", "user=admin")
+	scope := NewScope()
+	scope.Bind("port", nil)
+	scope.Bind("twice", func(n int64) int64 { return n * 2 })
+	cases := []struct {
+		policy ShadowPolicy
+		expect any
+	}{
+		{ShadowFirst, "localhost::80"},
+		{ShadowLast, "example.com:admin:"},
+		{ShadowNonNil, "localhost:admin:80"},
+	}
+	for _, item := range cases {
+		ctx := NewChainContext(defaults, env).Append(scope).Shadow(item.policy)
+		ret, err := EvalWith("host + ':' + (user ?? '') + ':' + (port ?? '')", ctx, EvalOptions{})
+		assert.Equal(t, nil, err)
+		assert.Equal(t, item.expect, ret)
+	}
+
+	ctx := NewChainContext(env, scope)
+	ret, err := EvalWith("twice(len(host))", ctx, EvalOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(22), ret)
+	_, err = EvalWith("nothing", ctx, EvalOptions{Strict: true})
+	assert.Equal(t, KindUndefined, err.(*EvalError).Kind)
+}
+
+func TestChainContext_FuncNames(t *testing.T) {
+	data, err := ParseJSON([]byte(`{"max": 10, "first": "a"}`))
+	assert.Equal(t, nil, err)
+	ctx := NewChainContext(NewScope(), data)
+	ret, err := EvalWith("first + (max + 1)", ctx, EvalOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a11", ret)
+	ret, err = EvalWith("max(first(values({'a': 1})), 2)", ctx, EvalOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(2), ret)
+}
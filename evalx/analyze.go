@@ -0,0 +1,191 @@
+package evalx
+
+import (
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// Analysis lists what an expression reads. Idents are the free identifiers,
+// Paths the dotted member paths selected from them and Functions what is
+// called, by name or by path. Those are sorted, Constants holds the distinct
+// literal values in the order they appear.
+type Analysis struct {
+	Idents    []string
+	Paths     []string
+	Functions []string
+	Constants []any
+}
+
+func Analyze(text string) (*Analysis, error) {
+	expr, err := exprOf(text, TopScope())
+	if err != nil {
+		return nil, err
+	}
+	an := &analyzer{
+		idents: map[string]bool{},
+		paths:  map[string]bool{},
+		funcs:  map[string]bool{},
+		seen:   map[any]bool{},
+	}
+	an.walk(expr)
+	return &Analysis{
+		Idents:    sortedSet(an.idents),
+		Paths:     sortedSet(an.paths),
+		Functions: sortedSet(an.funcs),
+		Constants: an.consts,
+	}, nil
+}
+
+type analyzer struct {
+	idents map[string]bool
+	paths  map[string]bool
+	funcs  map[string]bool
+	consts []any
+	seen   map[any]bool
+	// params are the names bound by the enclosing lambdas
+	params []map[string]bool
+}
+
+func sortedSet(set map[string]bool) []string {
+	var ret []string
+	for key := range set {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (it *analyzer) constant(val any) {
+	if !it.seen[val] {
+		it.seen[val] = true
+		it.consts = append(it.consts, val)
+	}
+}
+
+func (it *analyzer) bound(name string) bool {
+	for _, params := range it.params {
+		if params[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// path resolves a chain of selectors on a free identifier, it records the
+// identifier only if the chain resolves
+func (it *analyzer) path(input ast.Expr) (string, bool) {
+	switch expr := input.(type) {
+	case *ast.Ident:
+		if _, ok := constOf(expr.Name); ok || it.bound(expr.Name) {
+			return "", false
+		}
+		it.idents[expr.Name] = true
+		return expr.Name, true
+	case *ast.SelectorExpr:
+		if path, ok := it.path(expr.X); ok {
+			return path + "." + expr.Sel.Name, true
+		}
+	case *SafeSelectorExpr:
+		if path, ok := it.path(expr.X); ok {
+			return path + "." + expr.Sel.Name, true
+		}
+	case *ast.ParenExpr:
+		return it.path(expr.X)
+	}
+	return "", false
+}
+
+func (it *analyzer) member(x ast.Expr, sel *ast.Ident) {
+	if path, ok := it.path(x); ok {
+		it.paths[path+"."+sel.Name] = true
+	} else {
+		it.walk(x)
+	}
+}
+
+func (it *analyzer) call(expr *ast.CallExpr) {
+	var x ast.Expr
+	var sel *ast.Ident
+	switch fun := expr.Fun.(type) {
+	case *ast.Ident:
+		if _, ok := constOf(fun.Name); !ok && !it.bound(fun.Name) {
+			it.funcs[fun.Name] = true
+		}
+	case *ast.SelectorExpr:
+		x, sel = fun.X, fun.Sel
+	case *SafeSelectorExpr:
+		x, sel = fun.X, fun.Sel
+	default:
+		it.walk(fun)
+	}
+	if sel != nil {
+		if path, ok := it.path(x); ok {
+			it.funcs[path+"."+sel.Name] = true
+			if strings.Contains(path, ".") {
+				it.paths[path] = true
+			}
+		} else {
+			it.walk(x)
+		}
+	}
+	for _, arg := range expr.Args {
+		it.walk(arg)
+	}
+}
+
+func (it *analyzer) walk(input ast.Expr) {
+	switch expr := input.(type) {
+	case *ast.Ident:
+		if val, ok := constOf(expr.Name); ok {
+			it.constant(val)
+		} else if !it.bound(expr.Name) {
+			it.idents[expr.Name] = true
+		}
+	case *ast.BasicLit:
+		it.constant(evalBasicLit(expr))
+	case *DurationLit:
+		it.constant(expr.Duration)
+	case *ast.SelectorExpr:
+		it.member(expr.X, expr.Sel)
+	case *SafeSelectorExpr:
+		it.member(expr.X, expr.Sel)
+	case *ast.CallExpr:
+		it.call(expr)
+	case *ast.ParenExpr:
+		it.walk(expr.X)
+	case *ast.UnaryExpr:
+		it.walk(expr.X)
+	case *ast.BinaryExpr:
+		it.walk(expr.X)
+		it.walk(expr.Y)
+	case *ast.IndexExpr:
+		it.walk(expr.X)
+		it.walk(expr.Index)
+	case *ast.SliceExpr:
+		for _, item := range []ast.Expr{expr.X, expr.Low, expr.High} {
+			if item != nil {
+				it.walk(item)
+			}
+		}
+	case *ast.CompositeLit:
+		for _, elt := range expr.Elts {
+			it.walk(elt)
+		}
+	case *ast.KeyValueExpr:
+		it.walk(expr.Key)
+		it.walk(expr.Value)
+	case *CondExpr:
+		it.walk(expr.Cond)
+		it.walk(expr.X)
+		it.walk(expr.Y)
+	case *LambdaExpr:
+		params := map[string]bool{}
+		for _, param := range expr.Params {
+			params[param.Name] = true
+		}
+		it.params = append(it.params, params)
+		it.walk(expr.Body)
+		it.params = it.params[:len(it.params)-1]
+	}
+}
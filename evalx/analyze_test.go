@@ -0,0 +1,46 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	cases := map[string]*Analysis{
+		"order.items.price * qty > 100": {
+			Idents:    []string{"order", "qty"},
+			Paths:     []string{"order.items.price"},
+			Constants: []any{int64(100)},
+		},
+		"sum(map(order.items, i -> i.price * i.qty)) + fee ?? 0": {
+			Idents:    []string{"fee", "order"},
+			Paths:     []string{"order.items"},
+			Functions: []string{"map", "sum"},
+			Constants: []any{int64(0)},
+		},
+		"user?.profile.getName() + ' ' + user.tags[0].label": {
+			Idents:    []string{"user"},
+			Paths:     []string{"user.profile", "user.tags"},
+			Functions: []string{"user.profile.getName"},
+			Constants: []any{" ", int64(0)},
+		},
+		"x == nil ? 'a' : 'a'": {
+			Idents:    []string{"x"},
+			Constants: []any{nil, "a"},
+		},
+		"{'k': v, 'n': [1, true]}[key]": {
+			Idents:    []string{"key", "v"},
+			Constants: []any{"k", "n", int64(1), true},
+		},
+		"(x, y) -> x + y + z": {
+			Idents: []string{"z"},
+		},
+	}
+	for text, expect := range cases {
+		ret, err := Analyze(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+	_, err := Analyze("a +")
+	assert.Equal(t, KindSyntax, err.(*EvalError).Kind)
+}
@@ -0,0 +1,126 @@
+package evalx
+
+import (
+	"go/ast"
+	"go/token"
+	"time"
+)
+
+// Tokens beyond the go/token set, used as the Op of an ast.BinaryExpr
+const (
+	COALESCE token.Token = iota + 1000 // ??
+	IN                                 // in
+)
+
+var tokens = map[token.Token]string{
+	COALESCE: "??",
+	IN:       "in",
+
+	tokQuestion:   "?",
+	tokSafePeriod: "?.",
+	tokArrow:      "->",
+}
+
+func tokenString(tok token.Token) string {
+	if str, ok := tokens[tok]; ok {
+		return str
+	}
+	return tok.String()
+}
+
+// extNode satisfies the unexported marker method of ast.Expr, so the syntax
+// that go/ast has no node for can live in the same tree
+type extNode struct {
+	ast.Expr
+}
+
+// CondExpr is the ternary operator: Cond ? X : Y
+type CondExpr struct {
+	extNode
+	Cond     ast.Expr
+	Question token.Pos
+	X        ast.Expr
+	Colon    token.Pos
+	Y        ast.Expr
+}
+
+func (it *CondExpr) Pos() token.Pos {
+	return it.Cond.Pos()
+}
+
+func (it *CondExpr) End() token.Pos {
+	return it.Y.End()
+}
+
+// SafeSelectorExpr is the safe navigation operator: X?.Sel, evaluates to
+// nil instead of selecting from a nil X
+type SafeSelectorExpr struct {
+	extNode
+	X   ast.Expr
+	Sel *ast.Ident
+}
+
+func (it *SafeSelectorExpr) Pos() token.Pos {
+	return it.X.Pos()
+}
+
+func (it *SafeSelectorExpr) End() token.Pos {
+	return it.Sel.End()
+}
+
+// LambdaExpr is an anonymous function: x -> Body or (x, y) -> Body, its
+// parameters are bound on a child Scope of the Context it is defined in. It
+// runs with the options and limits of the evaluation calling it, and is
+// returned from an evaluation as a func(args ...any) any.
+type LambdaExpr struct {
+	extNode
+	Lparen token.Pos
+	Params []*ast.Ident
+	Arrow  token.Pos
+	Body   ast.Expr
+}
+
+func (it *LambdaExpr) Pos() token.Pos {
+	if it.Lparen.IsValid() {
+		return it.Lparen
+	} else if len(it.Params) > 0 {
+		return it.Params[0].Pos()
+	}
+	return it.Arrow
+}
+
+func (it *LambdaExpr) End() token.Pos {
+	return it.Body.End()
+}
+
+// ScriptExpr is a list of statements, evaluating to the value of the last
+// executed one
+type ScriptExpr struct {
+	extNode
+	Body *ast.BlockStmt
+}
+
+func (it *ScriptExpr) Pos() token.Pos {
+	return it.Body.Pos()
+}
+
+func (it *ScriptExpr) End() token.Pos {
+	return it.Body.End()
+}
+
+// DurationLit is a time.Duration literal, a number directly followed by its
+// units like 5m or 2h30m
+type DurationLit struct {
+	extNode
+	ValuePos token.Pos
+	Value    string
+	Duration time.Duration
+}
+
+func (it *DurationLit) Pos() token.Pos {
+	return it.ValuePos
+}
+
+func (it *DurationLit) End() token.Pos {
+	return it.ValuePos + token.Pos(len(it.Value))
+}
@@ -0,0 +1,376 @@
+package evalx
+
+import (
+	"fmt"
+	"github.com/avicd/go-utilx/bufx"
+	"github.com/avicd/go-utilx/conv"
+	"github.com/avicd/go-utilx/refx"
+	"go/token"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var regexpCache = &bufx.LruCache[string, *regexp.Regexp]{Size: 100}
+
+// Builtins returns the functions bound on the top scope by default, single
+// entries can be overridden with TopScope().Bind or removed with UnBind
+func Builtins() map[string]any {
+	return map[string]any{
+		// string
+		"upper":   strings.ToUpper,
+		"lower":   strings.ToLower,
+		"trim":    builtinTrim,
+		"split":   strings.Split,
+		"join":    builtinJoin,
+		"replace": builtinReplace,
+		"matches": builtinMatches,
+		// collection
+		"len":    builtinLen,
+		"first":  builtinFirst,
+		"last":   builtinLast,
+		"keys":   builtinKeys,
+		"values": builtinValues,
+		"sum":    builtinSum,
+		"min":    builtinMin,
+		"max":    builtinMax,
+		// higher order
+		"filter": builtinFilter,
+		"map":    builtinMap,
+		"any":    builtinAny,
+		"all":    builtinAll,
+		"sortBy": builtinSortBy,
+		// conversion
+		"int":    builtinInt,
+		"float":  builtinFloat,
+		"string": stringOf,
+		"bool":   refx.AsBool,
+		// time
+		"now":        time.Now,
+		"since":      time.Since,
+		"date":       builtinDate,
+		"duration":   time.ParseDuration,
+		"unix":       builtinUnix,
+		"formatTime": builtinFormatTime,
+	}
+}
+
+func builtinTrim(text string, cutset ...string) string {
+	if len(cutset) > 0 {
+		return strings.Trim(text, cutset[0])
+	}
+	return strings.TrimSpace(text)
+}
+
+func builtinJoin(list any, sep string) string {
+	var items []string
+	for _, item := range refx.AsList(list) {
+		items = append(items, refx.AsString(item))
+	}
+	return strings.Join(items, sep)
+}
+
+func builtinReplace(text string, old string, new string) string {
+	return strings.ReplaceAll(text, old, new)
+}
+
+func builtinMatches(text string, pattern string) (bool, error) {
+	re, ok := regexpCache.Get(pattern)
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return false, err
+		}
+		regexpCache.Put(pattern, re)
+	}
+	return re.MatchString(text), nil
+}
+
+func builtinLen(val any) int {
+	if refx.IsNil(val) {
+		return 0
+	}
+	if refx.IsString(val) {
+		return utf8.RuneCountInString(refx.AsString(val))
+	}
+	el := refx.Indirect(val)
+	switch el.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return el.Len()
+	}
+	panic(newError(KindTypeMismatch, "invalid argument %s for len", refx.TypeOf(val)))
+}
+
+func builtinFirst(list any) any {
+	if items := refx.AsList(list); len(items) > 0 {
+		return items[0]
+	}
+	return nil
+}
+
+func builtinLast(list any) any {
+	if items := refx.AsList(list); len(items) > 0 {
+		return items[len(items)-1]
+	}
+	return nil
+}
+
+func sortedKeys(obj any) []any {
+	var keys []any
+	refx.ForEach(obj, func(key any, val any) {
+		keys = append(keys, key)
+	})
+	sort.SliceStable(keys, func(i, j int) bool {
+		if cmp := refx.Cmp(keys[i], keys[j]); cmp != refx.CmpNeq {
+			return cmp == refx.CmpLss
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+func builtinKeys(obj any) []any {
+	if !refx.IsMap(obj) && !refx.IsStruct(obj) {
+		panic(newError(KindTypeMismatch, "invalid argument %s for keys", refx.TypeOf(obj)))
+	}
+	return sortedKeys(obj)
+}
+
+func builtinValues(obj any) []any {
+	if !refx.IsMap(obj) && !refx.IsStruct(obj) {
+		panic(newError(KindTypeMismatch, "invalid argument %s for values", refx.TypeOf(obj)))
+	}
+	var values []any
+	for _, key := range sortedKeys(obj) {
+		val, _ := refx.PropOf(obj, key)
+		values = append(values, val)
+	}
+	return values
+}
+
+// numbersOf accepts either a single list or the numbers themselves
+func numbersOf(name string, args []any) []any {
+	if len(args) == 1 && refx.IsList(args[0]) {
+		args = refx.AsList(args[0])
+	}
+	for _, arg := range args {
+		if !isNumeric(arg) {
+			panic(newError(KindTypeMismatch, "invalid argument %v for %s", arg, name))
+		}
+	}
+	return args
+}
+
+func builtinSum(args ...any) any {
+	var ret any = int64(0)
+	for _, num := range numbersOf("sum", args) {
+		ret = evalArithmetic(token.ADD, ret, num)
+	}
+	return ret
+}
+
+func builtinMin(args ...any) any {
+	var ret any
+	for _, num := range numbersOf("min", args) {
+		if ret == nil || refx.Cmp(num, ret) == refx.CmpLss {
+			ret = num
+		}
+	}
+	return ret
+}
+
+func builtinMax(args ...any) any {
+	var ret any
+	for _, num := range numbersOf("max", args) {
+		if ret == nil || refx.Cmp(num, ret) == refx.CmpGtr {
+			ret = num
+		}
+	}
+	return ret
+}
+
+func builtinInt(val any) int64 {
+	switch tmp := val.(type) {
+	case *big.Int:
+		return tmp.Int64()
+	case *big.Rat:
+		return new(big.Int).Quo(tmp.Num(), tmp.Denom()).Int64()
+	case *big.Float:
+		ret, _ := tmp.Int64()
+		return ret
+	}
+	switch {
+	case refx.IsNil(val):
+		return 0
+	case refx.IsBool(val):
+		if refx.AsBool(val) {
+			return 1
+		}
+		return 0
+	case refx.IsNumber(val), refx.IsString(val):
+		return refx.AsInt64(val)
+	}
+	panic(newError(KindTypeMismatch, "can't convert %s to int", refx.TypeOf(val)))
+}
+
+func builtinFloat(val any) float64 {
+	switch tmp := val.(type) {
+	case *big.Int:
+		ret, _ := new(big.Float).SetInt(tmp).Float64()
+		return ret
+	case *big.Rat:
+		ret, _ := tmp.Float64()
+		return ret
+	case *big.Float:
+		ret, _ := tmp.Float64()
+		return ret
+	}
+	switch {
+	case refx.IsNil(val):
+		return 0
+	case refx.IsBool(val):
+		if refx.AsBool(val) {
+			return 1
+		}
+		return 0
+	case refx.IsNumber(val), refx.IsString(val):
+		return refx.AsFloat64(val)
+	}
+	panic(newError(KindTypeMismatch, "can't convert %s to float", refx.TypeOf(val)))
+}
+
+func builtinUnix(t time.Time) int64 {
+	return t.Unix()
+}
+
+func builtinFormatTime(t time.Time, layout ...string) string {
+	if len(layout) > 0 {
+		return t.Format(layout[0])
+	}
+	return t.Format(conv.DateTime)
+}
+
+// callbackOf adapts fn to the signature of a compiled lambda, any other
+// function receives as many of the arguments as it declares
+func callbackOf(fn any) func(args ...any) any {
+	if lambda, ok := fn.(func(args ...any) any); ok {
+		return lambda
+	}
+	method := refx.ValueOf(fn)
+	if method.Kind() != reflect.Func {
+		panic(newError(KindTypeMismatch, "%s is not a function", refx.TypeOf(fn)))
+	}
+	fnType := method.Type()
+	return func(args ...any) any {
+		if !fnType.IsVariadic() && len(args) > fnType.NumIn() {
+			args = args[:fnType.NumIn()]
+		}
+		if err := arityError("function", fnType, len(args), false); err != nil {
+			panic(err)
+		}
+		ret, err := callOf("function", method, args)
+		if err != nil {
+			panic(err)
+		}
+		return ret
+	}
+}
+
+// eachOf visits the elements of a list with their index, or the entries
+// of a map or struct as value and key in the order of their keys
+func eachOf(coll any, fn func(val any, key any)) {
+	if refx.IsList(coll) {
+		refx.ForEach(coll, func(key any, val any) {
+			fn(val, key)
+		})
+		return
+	}
+	if !refx.IsMap(coll) && !refx.IsStruct(coll) {
+		if refx.IsNil(coll) {
+			return
+		}
+		panic(newError(KindTypeMismatch, "can't iterate over %s", refx.TypeOf(coll)))
+	}
+	for _, key := range sortedKeys(coll) {
+		val, _ := refx.PropOf(coll, key)
+		fn(val, key)
+	}
+}
+
+func builtinFilter(coll any, fn any) any {
+	call := callbackOf(fn)
+	if refx.IsMap(coll) {
+		src := refx.Indirect(coll)
+		ret := reflect.MakeMap(src.Type())
+		eachOf(coll, func(val any, key any) {
+			if refx.AsBool(call(val, key)) {
+				index := refx.ValueOf(key)
+				ret.SetMapIndex(index, src.MapIndex(index))
+			}
+		})
+		return ret.Interface()
+	}
+	ret := []any{}
+	eachOf(coll, func(val any, key any) {
+		if refx.AsBool(call(val, key)) {
+			ret = append(ret, val)
+		}
+	})
+	return ret
+}
+
+func builtinMap(coll any, fn any) []any {
+	call := callbackOf(fn)
+	ret := []any{}
+	eachOf(coll, func(val any, key any) {
+		ret = append(ret, call(val, key))
+	})
+	return ret
+}
+
+func builtinAny(coll any, fn any) bool {
+	call := callbackOf(fn)
+	found := false
+	eachOf(coll, func(val any, key any) {
+		if !found && refx.AsBool(call(val, key)) {
+			found = true
+		}
+	})
+	return found
+}
+
+func builtinAll(coll any, fn any) bool {
+	call := callbackOf(fn)
+	pass := true
+	eachOf(coll, func(val any, key any) {
+		if pass && !refx.AsBool(call(val, key)) {
+			pass = false
+		}
+	})
+	return pass
+}
+
+func builtinSortBy(coll any, fn any) []any {
+	call := callbackOf(fn)
+	var items, keys []any
+	eachOf(coll, func(val any, key any) {
+		items = append(items, val)
+		keys = append(keys, call(val, key))
+	})
+	index := make([]int, len(items))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return refx.Cmp(keys[index[i]], keys[index[j]]) == refx.CmpLss
+	})
+	ret := make([]any, len(items))
+	for i, at := range index {
+		ret[i] = items[at]
+	}
+	return ret
+}
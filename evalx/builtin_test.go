@@ -0,0 +1,85 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltins(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"name":  " Allen ",
+		"items": []int{3, 1, 2},
+		"tags":  map[string]any{"b": 2, "a": 1},
+		"empty": nil,
+	})
+	cases := map[string]any{
+		"upper(trim(name))":                   "ALLEN",
+		"lower('ABC')":                        "abc",
+		"trim('--a--', '-')":                  "a",
+		"split('a,b', ',')":                   []string{"a", "b"},
+		"join(items, '-')":                    "3-1-2",
+		"replace('a.b.c', '.', '/')":          "a/b/c",
+		"matches('abc123', '^[a-z]+[0-9]+$')": true,
+		"len(items)":                          3,
+		"len(trim(name))":                     5,
+		"len(empty)":                          0,
+		"first(items)":                        3,
+		"last(items)":                         2,
+		"keys(tags)":                          []any{"a", "b"},
+		"values(tags)":                        []any{1, 2},
+		"sum(items)":                          int64(6),
+		"sum(1, 2.5)":                         3.5,
+		"min(items)":                          1,
+		"max(1, 5, 3)":                        int64(5),
+		"int('42') + 1":                       int64(43),
+		"float(1) / 2":                        0.5,
+		"string(12) + '!'":                    "12!",
+		"bool(1)":                             true,
+		"unix(now()) > 0":                     true,
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+	ret, err := scope.Eval("formatTime(now(), '2006')")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.Now().Format("2006"), ret)
+}
+
+func TestBuiltins_Matches(t *testing.T) {
+	scope := NewScope(map[string]any{"s": "a1"})
+	ret, err := scope.Eval("matches(s, '^[a-z][0-9]$')")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, ret)
+	_, err = scope.Eval("len(s) > 1 && matches(s, '[')")
+	if assert.NotEqual(t, nil, err) {
+		ee := err.(*EvalError)
+		assert.Equal(t, KindRuntime, ee.Kind)
+		assert.Equal(t, "matches(s, '[')", ee.Node)
+		assert.Equal(t, 15, ee.Column)
+	}
+	tp, err := Check("matches('a', 'b')", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, boolType, tp)
+}
+
+func TestBuiltins_Override(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"upper": func(s string) string {
+			return strings.Repeat(s, 2)
+		},
+	})
+	ret, _ := scope.Eval("upper('a')")
+	assert.Equal(t, "aa", ret)
+
+	defer TopScope().Bind("lower", Builtins()["lower"])
+	TopScope().Bind("lower", strings.ToUpper)
+	ret, _ = NewScope().Eval("lower('a')")
+	assert.Equal(t, "A", ret)
+	TopScope().UnBind("lower")
+	_, err := NewScope().Eval("lower('a')")
+	assert.NotEqual(t, nil, err)
+}
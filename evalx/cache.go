@@ -0,0 +1,107 @@
+package evalx
+
+import (
+	"github.com/avicd/go-utilx/bufx"
+	"go/ast"
+	"sync/atomic"
+)
+
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// Cache keeps parsed expressions by their source text and counts how it is
+// used, the underlying bufx.Cache can be swapped while the Cache is in use
+type Cache struct {
+	store     atomic.Value
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// cacheStore gives atomic.Value the same concrete type for any store
+type cacheStore struct {
+	bufx.Cache[string, ast.Expr]
+}
+
+// NewCache returns a Cache holding the size most recently used expressions
+func NewCache(size int) *Cache {
+	return WrapCache(&bufx.LruCache[string, ast.Expr]{Size: size})
+}
+
+// WrapCache counts the lookups of store, evictions are counted for a
+// bufx.LruCache or bufx.SimpleCache, whose OnEvict is still called
+func WrapCache(store bufx.Cache[string, ast.Expr]) *Cache {
+	if cache, ok := store.(*Cache); ok {
+		return cache
+	}
+	cache := &Cache{}
+	cache.setStore(store)
+	return cache
+}
+
+func (it *Cache) setStore(store bufx.Cache[string, ast.Expr]) {
+	switch tmp := store.(type) {
+	case *bufx.LruCache[string, ast.Expr]:
+		tmp.OnEvict = it.evicted(tmp.OnEvict)
+	case *bufx.SimpleCache[string, ast.Expr]:
+		tmp.OnEvict = it.evicted(tmp.OnEvict)
+	}
+	it.store.Store(cacheStore{store})
+}
+
+// evicted counts an eviction before handing it to the hook of the store
+func (it *Cache) evicted(hook func(key string, expr ast.Expr)) func(key string, expr ast.Expr) {
+	return func(key string, expr ast.Expr) {
+		it.evictions.Add(1)
+		if hook != nil {
+			hook(key, expr)
+		}
+	}
+}
+
+func (it *Cache) storeOf() bufx.Cache[string, ast.Expr] {
+	return it.store.Load().(cacheStore).Cache
+}
+
+func (it *Cache) Get(text string) (ast.Expr, bool) {
+	expr, ok := it.storeOf().Get(text)
+	if ok {
+		it.hits.Add(1)
+	} else {
+		it.misses.Add(1)
+	}
+	return expr, ok
+}
+
+func (it *Cache) Put(text string, expr ast.Expr) {
+	it.storeOf().Put(text, expr)
+}
+
+func (it *Cache) Remove(text string) bool {
+	return it.storeOf().Remove(text)
+}
+
+func (it *Cache) Len() int {
+	return it.storeOf().Len()
+}
+
+func (it *Cache) Clear() {
+	it.storeOf().Clear()
+}
+
+func (it *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      it.hits.Load(),
+		Misses:    it.misses.Load(),
+		Evictions: it.evictions.Load(),
+	}
+}
+
+func (it *Cache) ResetStats() {
+	it.hits.Store(0)
+	it.misses.Store(0)
+	it.evictions.Store(0)
+}
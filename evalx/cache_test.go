@@ -0,0 +1,63 @@
+package evalx
+
+import (
+	"fmt"
+	"github.com/avicd/go-utilx/bufx"
+	"github.com/stretchr/testify/assert"
+	"go/ast"
+	"sync"
+	"testing"
+)
+
+func TestScope_SetCache(t *testing.T) {
+	scope := NewScope().SetCache(NewCache(2))
+	for _, text := range []string{"1 + 1", "1 + 1", "2 + 2", "3 + 3", "1 + 1"} {
+		_, err := scope.Eval(text)
+		assert.Equal(t, nil, err)
+	}
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 4, Evictions: 2}, scope.CacheStats())
+	_, ok := DefaultCache().Get("3 + 3")
+	assert.False(t, ok)
+
+	store := &bufx.SimpleCache[string, ast.Expr]{Size: 1}
+	scope.SetCache(store)
+	scope.Eval("x -> x")
+	scope.Eval("map([1], x -> x)")
+	assert.Equal(t, 1, store.Len())
+	assert.Equal(t, CacheStats{Misses: 2, Evictions: 1}, scope.CacheStats())
+	assert.Equal(t, scope.exprCache(), newChildScope(scope).exprCache())
+
+	var dropped []string
+	lru := &bufx.LruCache[string, ast.Expr]{Size: 1, OnEvict: func(key string, expr ast.Expr) {
+		dropped = append(dropped, key)
+	}}
+	scope.SetCache(lru)
+	scope.Eval("1 + 2")
+	scope.Eval("3 + 4")
+	assert.Equal(t, []string{"1 + 2"}, dropped)
+	assert.Equal(t, CacheStats{Misses: 2, Evictions: 1}, scope.CacheStats())
+
+	scope.SetCache(nil)
+	assert.Equal(t, DefaultCache(), scope.exprCache())
+}
+
+func TestSetCacheSize(t *testing.T) {
+	defer SetCacheSize(1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if j%10 == 0 {
+					SetCacheSize(10 + j)
+				}
+				ret, err := Eval(fmt.Sprintf("%d + %d", id, j))
+				assert.Equal(t, nil, err)
+				assert.Equal(t, int64(id+j), ret)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, DefaultCache().Len(), 50)
+}
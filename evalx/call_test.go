@@ -0,0 +1,105 @@
+package evalx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testLevel uint8
+
+func TestEval_Call(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"nums":  []any{1, 2, 3},
+		"words": []string{"a", "b"},
+	})
+	scope.Bind("repeat", strings.Repeat)
+	scope.Bind("itoa", strconv.Itoa)
+	scope.Bind("atoi", strconv.Atoi)
+	scope.Bind("half", func(x float32) float32 { return x / 2 })
+	scope.Bind("level", func(l testLevel) string { return fmt.Sprint("L", l) })
+	scope.Bind("concat", func(sep string, items ...string) string {
+		return strings.Join(items, sep)
+	})
+	scope.Bind("total", func(items ...int) int {
+		ret := 0
+		for _, item := range items {
+			ret += item
+		}
+		return ret
+	})
+	scope.Bind("joinInts", func(items []int) string { return fmt.Sprint(items) })
+	scope.Bind("byte", func(b uint8) uint8 { return b })
+	scope.Bind("size", func(n uint) uint { return n })
+	cases := map[string]any{
+		"repeat('ab', 2)":             "abab",
+		"itoa(42)":                    "42",
+		"itoa(4.0)":                   "4",
+		"atoi('12') + 1":              int64(13),
+		"half(3)":                     float32(1.5),
+		"level(2)":                    "L2",
+		"concat('-')":                 "",
+		"concat('-', 'a', 'b')":       "a-b",
+		"concat('-', words...)":       "a-b",
+		"concat('+', ['x', 'y']...,)": "x+y",
+		"total(nums...)":              6,
+		"total(1, 2)":                 3,
+		"joinInts(nums)":              "[1 2 3]",
+		"map(['1', '2'], atoi)":       []any{1, 2},
+		"byte(255)":                   uint8(255),
+		"level(2.0)":                  "L2",
+		"size(0)":                     uint(0),
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+
+	errs := map[string]ErrorKind{
+		"atoi('x')":               KindRuntime,
+		"itoa(1.5)":               KindTypeMismatch,
+		"itoa('1')":               KindTypeMismatch,
+		"repeat(words..., 1)":     KindSyntax,
+		"repeat('a', nums...)":    KindArity,
+		"total(1, nums...)":       KindArity,
+		"concat('-', itoa(1)...)": KindTypeMismatch,
+		"byte(300)":               KindOverflow,
+		"byte(256.0)":             KindOverflow,
+		"size(-1)":                KindOverflow,
+		"level(-1)":               KindOverflow,
+		"half(1e40)":              KindOverflow,
+	}
+	for text, kind := range errs {
+		_, err := scope.Eval(text)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, kind, err.(*EvalError).Kind, text)
+		}
+	}
+	_, err := scope.Eval("atoi('x')")
+	assert.True(t, errors.Is(err, strconv.ErrSyntax))
+}
+
+func TestCheck_Call(t *testing.T) {
+	schema := map[string]reflect.Type{
+		"n":     reflect.TypeOf(int64(0)),
+		"words": reflect.TypeOf([]string{}),
+		"ok":    reflect.TypeOf(true),
+	}
+	TopScope().Bind("itoa", strconv.Itoa)
+	TopScope().Bind("concat", func(sep string, items ...string) string { return "" })
+	defer TopScope().UnBind("itoa")
+	defer TopScope().UnBind("concat")
+	for _, text := range []string{"itoa(n)", "concat('-', words...)", "concat('-', 'a')"} {
+		_, err := Check(text, schema)
+		assert.Equal(t, nil, err, text)
+	}
+	for _, text := range []string{"itoa(ok)", "itoa(n...)", "concat('-', n...)"} {
+		_, err := Check(text, schema)
+		assert.NotEqual(t, nil, err, text)
+	}
+}
@@ -0,0 +1,465 @@
+package evalx
+
+import (
+	"github.com/avicd/go-utilx/refx"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+var (
+	anyType    = refx.TypeOf(&refx.TAny).Elem()
+	boolType   = refx.TypeOf(refx.TBool)
+	int64Type  = refx.TypeOf(refx.TInt64)
+	uint64Type = refx.TypeOf(refx.TUint64)
+	floatType  = refx.TypeOf(refx.TFloat64)
+	stringType = refx.TypeOf("")
+	listType   = refx.TypeOf(refx.TSlice)
+	mapType    = refx.TypeOf(refx.TMapStrAny)
+	lambdaType = refx.TypeOf(func(args ...any) any { return nil })
+)
+
+// builtins whose second argument is called with the elements of the first
+var higherOrder = map[string]bool{
+	"filter": true,
+	"map":    true,
+	"any":    true,
+	"all":    true,
+	"sortBy": true,
+}
+
+// Check infers the result type of an expression against a schema without
+// evaluating it. The schema is a struct (or its reflect.Type) whose fields
+// and methods are the variables, or a map from names to reflect.Type or to
+// sample values. Names missing from the schema fall back to the top scope.
+// Interface typed values are dynamic and are not checked any further.
+func Check(text string, schema any) (reflect.Type, error) {
+	expr, err := exprOf(text, TopScope())
+	if err != nil {
+		return nil, err
+	}
+	ck := &checker{schema: schema}
+	return ck.run(strings.TrimSpace(text), expr)
+}
+
+type checker struct {
+	schema any
+	params []map[string]reflect.Type
+}
+
+func (ck *checker) run(text string, expr ast.Expr) (ret reflect.Type, err error) {
+	defer func() {
+		if rc := recover(); rc != nil {
+			ret = nil
+			err = asEvalError(rc).locate(text, expr)
+		}
+	}()
+	return ck.check(expr, PROPERTY), nil
+}
+
+func isDynamic(tp reflect.Type) bool {
+	return tp == nil || tp.Kind() == reflect.Interface
+}
+
+func (ck *checker) schemaTypeOf(name string, target Target) (reflect.Type, bool) {
+	if types, ok := ck.schema.(map[string]reflect.Type); ok {
+		tp, exist := types[name]
+		return tp, exist
+	}
+	if refx.IsMap(ck.schema) {
+		if val, ok := refx.PropOf(ck.schema, name); ok {
+			if tp, isType := val.(reflect.Type); isType {
+				return tp, true
+			}
+			return refx.TypeOf(val), true
+		}
+		return nil, false
+	}
+	return memberType(refx.TypeOf(ck.schema), name, target)
+}
+
+// memberType looks up the field, or the method if target is METHOD, of a
+// struct type
+func memberType(owner reflect.Type, name string, target Target) (reflect.Type, bool) {
+	if owner == nil {
+		return nil, false
+	}
+	if target == METHOD {
+		if method, ok := owner.MethodByName(name); ok {
+			return funcOfMethod(method), true
+		}
+		if owner.Kind() != reflect.Pointer {
+			if method, ok := reflect.PointerTo(owner).MethodByName(name); ok {
+				return funcOfMethod(method), true
+			}
+		}
+	}
+	if refx.IndirectKind(owner) == reflect.Struct {
+		return refx.TypeOfField(owner, name)
+	}
+	return nil, false
+}
+
+// funcOfMethod drops the receiver from the signature of a method
+func funcOfMethod(method reflect.Method) reflect.Type {
+	tp := method.Type
+	var in, out []reflect.Type
+	for i := 1; i < tp.NumIn(); i++ {
+		in = append(in, tp.In(i))
+	}
+	for i := 0; i < tp.NumOut(); i++ {
+		out = append(out, tp.Out(i))
+	}
+	return reflect.FuncOf(in, out, tp.IsVariadic())
+}
+
+func (ck *checker) identType(expr *ast.Ident, target Target) reflect.Type {
+	name := expr.Name
+	for i := len(ck.params) - 1; i >= 0; i-- {
+		if tp, ok := ck.params[i][name]; ok {
+			return tp
+		}
+	}
+	if tp, ok := ck.schemaTypeOf(name, target); ok {
+		return tp
+	}
+	if target == METHOD {
+		if fn, ok := TopScope().MethodOf(name); ok {
+			return refx.TypeOf(fn)
+		}
+		panic(newError(KindUndefined, "undefined function %s", name).at(expr))
+	}
+	if val, ok := TopScope().ValueOf(name); ok {
+		return refx.TypeOf(val)
+	}
+	panic(newError(KindUndefined, "undefined identifier %s", name).at(expr))
+}
+
+// funcRefType is the type of a name passed to a higher-order builtin, a
+// value or else a function as compileFuncRef resolves it
+func (ck *checker) funcRefType(expr *ast.Ident) reflect.Type {
+	if _, ok := constOf(expr.Name); ok {
+		return ck.check(expr, PROPERTY)
+	}
+	for i := len(ck.params) - 1; i >= 0; i-- {
+		if _, ok := ck.params[i][expr.Name]; ok {
+			return ck.identType(expr, PROPERTY)
+		}
+	}
+	if tp, ok := ck.schemaTypeOf(expr.Name, PROPERTY); ok {
+		return tp
+	}
+	if val, ok := TopScope().ValueOf(expr.Name); ok {
+		return refx.TypeOf(val)
+	}
+	return ck.identType(expr, METHOD)
+}
+
+func (ck *checker) check(buf ast.Expr, target Target) reflect.Type {
+	switch expr := buf.(type) {
+	case *ast.Ident:
+		switch expr.Name {
+		case "true", "false":
+			return boolType
+		case "nil", "null":
+			return anyType
+		}
+		return ck.identType(expr, target)
+	case *ast.BasicLit:
+		switch expr.Kind {
+		case token.INT:
+			return int64Type
+		case token.FLOAT:
+			return floatType
+		}
+		return stringType
+	case *DurationLit:
+		return durationType
+	case *ast.ParenExpr:
+		return ck.check(expr.X, target)
+	case *ast.SelectorExpr:
+		return ck.selectType(expr, ck.check(expr.X, PROPERTY), expr.Sel.Name, target)
+	case *SafeSelectorExpr:
+		return ck.selectType(expr, ck.check(expr.X, PROPERTY), expr.Sel.Name, target)
+	case *ast.IndexExpr:
+		return ck.indexType(expr)
+	case *ast.SliceExpr:
+		return ck.sliceType(expr)
+	case *ast.UnaryExpr:
+		return ck.unaryType(expr)
+	case *ast.BinaryExpr:
+		return ck.binaryType(expr)
+	case *ast.CallExpr:
+		return ck.callType(expr)
+	case *ast.CompositeLit:
+		for _, elt := range expr.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				ck.check(kv.Key, PROPERTY)
+				ck.check(kv.Value, PROPERTY)
+			} else {
+				ck.check(elt, PROPERTY)
+			}
+		}
+		if _, ok := expr.Type.(*ast.MapType); ok {
+			return mapType
+		}
+		return listType
+	case *CondExpr:
+		ck.check(expr.Cond, PROPERTY)
+		return commonType(ck.check(expr.X, PROPERTY), ck.check(expr.Y, PROPERTY))
+	case *LambdaExpr:
+		ck.lambdaType(expr, nil)
+		return lambdaType
+	}
+	return anyType
+}
+
+func commonType(x reflect.Type, y reflect.Type) reflect.Type {
+	if x == y {
+		return x
+	}
+	return anyType
+}
+
+func (ck *checker) selectType(node ast.Node, parent reflect.Type, name string, target Target) reflect.Type {
+	if isDynamic(parent) {
+		return anyType
+	}
+	if tp, ok := memberType(parent, name, target); ok {
+		return tp
+	}
+	switch refx.IndirectKind(parent) {
+	case reflect.Map:
+		return refx.IndirectType(parent).Elem()
+	case reflect.Struct:
+		panic(newError(KindUndefined, "undefined member %s of %s", name, parent).at(node))
+	}
+	panic(newError(KindTypeMismatch, "can't select %s from %s", name, parent).at(node))
+}
+
+func (ck *checker) indexType(expr *ast.IndexExpr) reflect.Type {
+	parent := ck.check(expr.X, PROPERTY)
+	index := ck.check(expr.Index, PROPERTY)
+	if isDynamic(parent) {
+		return anyType
+	}
+	switch refx.IndirectKind(parent) {
+	case reflect.Slice, reflect.Array:
+		if !isDynamic(index) && !refx.IsGeneralInt(index) {
+			panic(newError(KindTypeMismatch, "invalid index type %s", index).at(expr))
+		}
+		return refx.IndirectType(parent).Elem()
+	case reflect.Map:
+		return refx.IndirectType(parent).Elem()
+	case reflect.Struct:
+		if lit, ok := expr.Index.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			return ck.selectType(expr, parent, refx.AsString(evalBasicLit(lit)), PROPERTY)
+		}
+		return anyType
+	}
+	panic(newError(KindTypeMismatch, "can't index %s", parent).at(expr))
+}
+
+func (ck *checker) sliceType(expr *ast.SliceExpr) reflect.Type {
+	parent := ck.check(expr.X, PROPERTY)
+	for _, bound := range []ast.Expr{expr.Low, expr.High} {
+		if bound == nil {
+			continue
+		}
+		if tp := ck.check(bound, PROPERTY); !isDynamic(tp) && !refx.IsGeneralInt(tp) {
+			panic(newError(KindTypeMismatch, "invalid slice index type %s", tp).at(bound))
+		}
+	}
+	if isDynamic(parent) {
+		return anyType
+	}
+	switch refx.IndirectKind(parent) {
+	case reflect.String:
+		return stringType
+	case reflect.Slice:
+		return refx.IndirectType(parent)
+	case reflect.Array:
+		return listType
+	}
+	panic(newError(KindTypeMismatch, "can't slice %s", parent).at(expr))
+}
+
+// numberType is the type evalArithmetic produces for x and y
+func numberType(x reflect.Type, y reflect.Type) reflect.Type {
+	if isDynamic(x) || isDynamic(y) {
+		return anyType
+	}
+	if refx.IsGeneralInt(x) && refx.IsGeneralInt(y) {
+		return int64Type
+	}
+	return floatType
+}
+
+func (ck *checker) unaryType(expr *ast.UnaryExpr) reflect.Type {
+	x := ck.check(expr.X, PROPERTY)
+	if expr.Op == token.NOT {
+		return boolType
+	}
+	if isDynamic(x) {
+		return anyType
+	}
+	if !refx.IsNumber(x) {
+		panic(newError(KindTypeMismatch, "invalid operator '%s' on %s", expr.Op, x).at(expr))
+	}
+	if expr.Op == token.SUB {
+		switch {
+		case x == durationType:
+			return x
+		case refx.IsInteger(x):
+			return int64Type
+		case refx.IsUInteger(x):
+			return uint64Type
+		}
+		return floatType
+	}
+	return x
+}
+
+func isComparable(x reflect.Type, y reflect.Type) bool {
+	return isDynamic(x) || isDynamic(y) || x == y ||
+		refx.IsNumber(x) && refx.IsNumber(y) ||
+		refx.IsString(x) && refx.IsString(y)
+}
+
+func (ck *checker) binaryType(expr *ast.BinaryExpr) reflect.Type {
+	x := ck.check(expr.X, PROPERTY)
+	y := ck.check(expr.Y, PROPERTY)
+	mismatch := func() {
+		panic(newError(KindTypeMismatch, "invalid operation: %s %s %s", x, tokenString(expr.Op), y).at(expr))
+	}
+	switch expr.Op {
+	case token.LOR, token.LAND:
+		return boolType
+	case COALESCE:
+		return commonType(x, y)
+	case IN:
+		if !isDynamic(y) && !refx.IsString(y) && !refx.IsList(y) && !refx.IsMap(y) && !refx.IsStruct(y) {
+			mismatch()
+		}
+		return boolType
+	case token.EQL, token.NEQ:
+		if !isComparable(x, y) {
+			mismatch()
+		}
+		return boolType
+	case token.GTR, token.LSS, token.GEQ, token.LEQ:
+		if !isComparable(x, y) || !isDynamic(x) && !refx.IsNumber(x) && !refx.IsString(x) && x != timeType {
+			mismatch()
+		}
+		return boolType
+	case token.ADD:
+		if refx.IsString(x) || refx.IsString(y) {
+			return stringType
+		}
+		fallthrough
+	case token.SUB, token.MUL, token.QUO, token.REM:
+		if ret, ok := timeResultType(expr.Op, x, y); ok {
+			if ret == nil {
+				mismatch()
+			}
+			return ret
+		}
+		if !isDynamic(x) && !refx.IsNumber(x) || !isDynamic(y) && !refx.IsNumber(y) {
+			mismatch()
+		}
+		ret := numberType(x, y)
+		if expr.Op == token.REM && ret == floatType {
+			mismatch()
+		}
+		return ret
+	case token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
+		if !isDynamic(x) && !refx.IsGeneralInt(x) || !isDynamic(y) && !refx.IsGeneralInt(y) {
+			mismatch()
+		}
+		if isDynamic(x) || isDynamic(y) {
+			return anyType
+		}
+		return uint64Type
+	}
+	return anyType
+}
+
+func (ck *checker) callType(expr *ast.CallExpr) reflect.Type {
+	var fn reflect.Type
+	if safe, ok := expr.Fun.(*SafeSelectorExpr); ok {
+		fn = ck.selectType(safe, ck.check(safe.X, PROPERTY), safe.Sel.Name, METHOD)
+	} else {
+		fn = ck.check(expr.Fun, METHOD)
+	}
+	name := nameOf(expr.Fun)
+	var elem, key reflect.Type
+	ident, ok := expr.Fun.(*ast.Ident)
+	funcArgs := ok && higherOrder[ident.Name]
+	if funcArgs && len(expr.Args) > 0 {
+		elem, key = elemTypes(ck.check(expr.Args[0], PROPERTY))
+	}
+	var args []reflect.Type
+	for _, arg := range expr.Args {
+		if lambda, ok := arg.(*LambdaExpr); ok {
+			ck.lambdaType(lambda, []reflect.Type{elem, key})
+			args = append(args, lambdaType)
+		} else if ident, ok := arg.(*ast.Ident); ok && funcArgs {
+			args = append(args, ck.funcRefType(ident))
+		} else {
+			args = append(args, ck.check(arg, PROPERTY))
+		}
+	}
+	if isDynamic(fn) {
+		return anyType
+	}
+	if fn.Kind() != reflect.Func {
+		panic(newError(KindTypeMismatch, "%s is not a function", name).at(expr))
+	}
+	spread := expr.Ellipsis.IsValid()
+	if err := arityError(name, fn, len(args), spread); err != nil {
+		panic(err.at(expr))
+	}
+	for i, arg := range args {
+		param := paramOf(fn, i)
+		if spread && i == len(args)-1 {
+			param = fn.In(i)
+		}
+		if !coercible(arg, param) {
+			panic(newError(KindTypeMismatch, "can't use %s as %s in argument %d of %s",
+				arg, param, i+1, name).at(expr.Args[i]))
+		}
+	}
+	if fn.NumOut() > 0 {
+		return fn.Out(0)
+	}
+	return anyType
+}
+
+// elemTypes is what eachOf passes to a callback iterating over coll
+func elemTypes(coll reflect.Type) (reflect.Type, reflect.Type) {
+	if isDynamic(coll) {
+		return anyType, anyType
+	}
+	switch refx.IndirectKind(coll) {
+	case reflect.Slice, reflect.Array:
+		return refx.IndirectType(coll).Elem(), refx.TypeOf(0)
+	case reflect.Map:
+		tp := refx.IndirectType(coll)
+		return tp.Elem(), tp.Key()
+	}
+	return anyType, anyType
+}
+
+func (ck *checker) lambdaType(expr *LambdaExpr, types []reflect.Type) {
+	params := map[string]reflect.Type{}
+	for i, param := range expr.Params {
+		params[param.Name] = anyType
+		if i < len(types) && types[i] != nil {
+			params[param.Name] = types[i]
+		}
+	}
+	ck.params = append(ck.params, params)
+	ck.check(expr.Body, PROPERTY)
+	ck.params = ck.params[:len(ck.params)-1]
+}
@@ -0,0 +1,91 @@
+package evalx
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+type testOrder struct {
+	Total float64
+	Count int
+	Tags  []string
+	Meta  map[string]int
+	Owner *testEval
+	Extra any
+}
+
+type testSchema struct {
+	Name   string
+	Age    int
+	Orders []testOrder
+	Rate   func(level int) float64
+}
+
+func TestCheck(t *testing.T) {
+	schema := &testSchema{}
+	valid := map[string]reflect.Type{
+		"Name + '!'":                         stringType,
+		"Age * 2":                            int64Type,
+		"Age / 2.0":                          floatType,
+		"Age >= 18 && Name != ''":            boolType,
+		"Orders[0].Total":                    floatType,
+		"Orders[0].Owner.GetName('x')":       stringType,
+		"Orders[0].Meta['a'] + 1":            int64Type,
+		"Orders[0].Extra.anything.goes":      anyType,
+		"Rate(Age)":                          floatType,
+		"len(Orders) > 0 ? Name : 'none'":    stringType,
+		"filter(Orders, o -> o.Total > 100)": anyType,
+		"map(Orders, o -> o.Owner.B)":        listType,
+		"upper(Name)":                        stringType,
+		"'vip' in Orders[0].Tags":            boolType,
+		"Name[1:]":                           stringType,
+	}
+	for text, expect := range valid {
+		tp, err := Check(text, schema)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, tp, text)
+	}
+
+	invalid := map[string]ErrorKind{
+		"Nmae":                              KindUndefined,
+		"Orders[0].Totl":                    KindUndefined,
+		"Name()":                            KindTypeMismatch,
+		"Name > 3":                          KindTypeMismatch,
+		"Age - 'x'":                         KindTypeMismatch,
+		"Rate(Name)":                        KindTypeMismatch,
+		"Rate(1, 2)":                        KindArity,
+		"filter(Orders, o -> o.Totl > 100)": KindUndefined,
+		"missing(1)":                        KindUndefined,
+		"Age[0]":                            KindTypeMismatch,
+	}
+	for text, kind := range invalid {
+		_, err := Check(text, schema)
+		var ee *EvalError
+		assert.Equal(t, true, errors.As(err, &ee), text)
+		if ee != nil {
+			assert.Equal(t, kind, ee.Kind, text)
+		}
+	}
+
+	types := map[string]reflect.Type{
+		"price": floatType,
+		"user":  reflect.TypeOf(testEval{}),
+	}
+	tp, err := Check("price * user.A", types)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, floatType, tp)
+	_, err = Check("user.GetName('a')", types)
+	assert.Equal(t, nil, err)
+
+	type hidden struct {
+		Name string
+		code int
+	}
+	_, err = Check("item.code", map[string]any{"item": hidden{}})
+	assert.Equal(t, KindUndefined, err.(*EvalError).Kind)
+	tp, err = Check("item.Name", map[string]any{"item": &hidden{}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, stringType, tp)
+}
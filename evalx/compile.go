@@ -0,0 +1,721 @@
+package evalx
+
+import (
+	"context"
+	"github.com/avicd/go-utilx/refx"
+	"go/ast"
+	"go/token"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+type evalFunc func(stack *Stack) any
+
+// Program is an expression compiled into a tree of closures. Literals and
+// operators are resolved once, identifiers are looked up through the Context
+// passed to Run. A Program is immutable and safe for concurrent use.
+type Program struct {
+	text string
+	expr ast.Expr
+	eval evalFunc
+}
+
+func Compile(text string) (*Program, error) {
+	return programOf(text, TopScope())
+}
+
+func MustCompile(text string) *Program {
+	prog, err := Compile(text)
+	if err != nil {
+		panic(err)
+	}
+	return prog
+}
+
+func newProgram(text string, expr ast.Expr) *Program {
+	return &Program{text: strings.TrimSpace(text), expr: expr, eval: compileExpr(Simplify(expr), PROPERTY)}
+}
+
+// compiledExpr is cached in place of a parsed expression once it has been
+// compiled, so that running the same text again skips the compilation
+type compiledExpr struct {
+	ast.Expr
+	eval evalFunc
+}
+
+// cachedProgram makes a Program of what ctx caches under key, or else of
+// what parse returns, and caches it compiled
+func cachedProgram(ctx Context, text string, key string, parse func() (ast.Expr, error)) (*Program, error) {
+	var expr ast.Expr
+	if ae, ok := ctx.CacheOf(key); ok {
+		if tmp, ok := ae.(*compiledExpr); ok {
+			return &Program{text: strings.TrimSpace(text), expr: tmp.Expr, eval: tmp.eval}, nil
+		}
+		expr = ae
+	} else {
+		var err error
+		if expr, err = parse(); err != nil {
+			return nil, syntaxError(strings.TrimSpace(text), err)
+		}
+	}
+	prog := newProgram(text, expr)
+	ctx.Cache(key, &compiledExpr{Expr: expr, eval: prog.eval})
+	return prog, nil
+}
+
+func (it *Program) String() string {
+	return it.text
+}
+
+func (it *Program) Run(ctx Context) (any, error) {
+	return it.RunWith(ctx, EvalOptions{})
+}
+
+func (it *Program) RunWith(ctx Context, opts EvalOptions) (any, error) {
+	return it.RunContext(context.Background(), ctx, opts)
+}
+
+// RunContext aborts with a KindLimit error once goCtx is done or one of the
+// Limits of opts is exceeded
+func (it *Program) RunContext(goCtx context.Context, ctx Context, opts EvalOptions) (any, error) {
+	if ctx == nil {
+		ctx = NewScope()
+	}
+	if opts.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		goCtx, cancel = context.WithTimeout(goCtx, opts.Limits.Timeout)
+		defer cancel()
+	}
+	stack := StackOf(ctx)
+	stack.Options = opts
+	stack.limit = newLimiter(goCtx, opts.Limits)
+	return it.run(stack)
+}
+
+func (it *Program) run(stack *Stack) (ret any, err error) {
+	defer func() {
+		if rc := recover(); rc != nil {
+			ret = nil
+			err = asEvalError(rc).locate(it.text, it.expr)
+		}
+	}()
+	ret = it.eval(stack)
+	if stack.Error != nil {
+		return nil, stack.Error
+	}
+	// a lambda outliving the evaluation is no longer bound by its limits
+	if fn, ok := ret.(*lambda); ok {
+		ret = fn.bind(&Stack{Options: stack.Options})
+	}
+	return ret, nil
+}
+
+func compileExpr(buf ast.Expr, target Target) evalFunc {
+	fn := compileNode(buf, target)
+	return func(stack *Stack) any {
+		if stack.limit != nil {
+			stack.limit.step()
+		}
+		return fn(stack)
+	}
+}
+
+func compileNode(buf ast.Expr, target Target) evalFunc {
+	switch expr := buf.(type) {
+	case *ast.SelectorExpr:
+		return compileSelector(expr, target)
+	case *ast.Ident:
+		return compileIdent(expr, target, false)
+	case *ast.BasicLit:
+		if expr.Kind == token.INT || expr.Kind == token.FLOAT {
+			return compileNumber(expr)
+		}
+		val := evalBasicLit(expr)
+		return func(stack *Stack) any {
+			return val
+		}
+	case *DurationLit:
+		return func(stack *Stack) any {
+			return expr.Duration
+		}
+	case *ast.UnaryExpr:
+		return guard(expr, compileUnary(expr))
+	case *ast.ParenExpr:
+		return compileExpr(expr.X, target)
+	case *ast.IndexExpr:
+		return compileIndex(expr, target)
+	case *ast.CallExpr:
+		return guard(expr, compileCall(expr))
+	case *ast.BinaryExpr:
+		return compileBinary(expr)
+	case *ast.CompositeLit:
+		return compileCompositeLit(expr)
+	case *ast.SliceExpr:
+		return guard(expr, compileSlice(expr))
+	case *CondExpr:
+		return compileCond(expr)
+	case *SafeSelectorExpr:
+		return compileSafeSelector(expr, target)
+	case *LambdaExpr:
+		return compileLambda(expr)
+	case *ScriptExpr:
+		return compileBlock(expr.Body.List)
+	}
+	return func(stack *Stack) any {
+		return nil
+	}
+}
+
+func memberOf(parent any, key any, target Target) (any, bool) {
+	if parent == nil {
+		return nil, false
+	}
+	if obj, ok := parent.(map[string]any); ok && target == PROPERTY {
+		if name, ok := key.(string); ok {
+			val, exist := obj[name]
+			return val, exist
+		}
+	}
+	if target == METHOD {
+		if method, ok := refx.MethodOf(parent, key); ok {
+			return method, true
+		}
+	}
+	if val, ok := refx.PropOf(parent, key); ok {
+		if target == METHOD {
+			if isCallable(val) {
+				return val, true
+			}
+		} else {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// selectOf selects key from parent, a missing member of a non nil parent is
+// an error in strict mode
+func selectOf(stack *Stack, node ast.Node, parent any, key any, target Target) any {
+	val, ok := memberOf(parent, key, target)
+	if !ok && stack.Options.Strict && target == PROPERTY && !refx.IsNil(parent) {
+		if refx.IsList(parent) {
+			panic(newMissing("index %v out of range", key).at(node))
+		}
+		panic(newMissing("undefined member %v of %s", key, refx.TypeOf(parent)).at(node))
+	}
+	return val
+}
+
+func compileSelector(expr *ast.SelectorExpr, target Target) evalFunc {
+	var parent evalFunc
+	if exprX, ok := expr.X.(*ast.Ident); ok {
+		parent = compileIdent(exprX, PROPERTY, true)
+	} else {
+		parent = compileExpr(expr.X, PROPERTY)
+	}
+	name := expr.Sel.Name
+	return func(stack *Stack) any {
+		return selectOf(stack, expr, parent(stack), name, target)
+	}
+}
+
+func compileSafeSelector(expr *SafeSelectorExpr, target Target) evalFunc {
+	parent := compileExpr(expr.X, PROPERTY)
+	name := expr.Sel.Name
+	return func(stack *Stack) any {
+		obj := parent(stack)
+		if refx.IsNil(obj) {
+			return nil
+		}
+		return selectOf(stack, expr, obj, name, target)
+	}
+}
+
+func compileIndex(expr *ast.IndexExpr, target Target) evalFunc {
+	obj := compileExpr(expr.X, PROPERTY)
+	index := compileExpr(expr.Index, PROPERTY)
+	return func(stack *Stack) any {
+		return selectOf(stack, expr, obj(stack), index(stack), target)
+	}
+}
+
+func constOf(name string) (any, bool) {
+	switch name {
+	case "nil", "null":
+		return nil, true
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return nil, false
+}
+
+func compileIdent(expr *ast.Ident, target Target, sel bool) evalFunc {
+	if val, ok := constOf(expr.Name); ok && !sel {
+		return func(stack *Stack) any {
+			return val
+		}
+	}
+	name := expr.Name
+	return func(stack *Stack) any {
+		if target == METHOD {
+			if method, ok := stack.Ctx.MethodOf(name); ok {
+				return method
+			}
+		}
+		if val, ok := stack.Ctx.ValueOf(name); ok {
+			if target == METHOD {
+				if isCallable(val) {
+					return val
+				}
+			} else {
+				return val
+			}
+		} else if stack.Options.Strict && target == PROPERTY {
+			panic(newMissing("undefined identifier %s", name).at(expr))
+		}
+		return nil
+	}
+}
+
+// compileFuncRef compiles a name passed to a higher-order builtin, which
+// may name a function like upper as well as a value
+func compileFuncRef(expr *ast.Ident) evalFunc {
+	if val, ok := constOf(expr.Name); ok {
+		return func(stack *Stack) any {
+			return val
+		}
+	}
+	name := expr.Name
+	return func(stack *Stack) any {
+		if val, ok := stack.Ctx.ValueOf(name); ok {
+			return val
+		}
+		if method, ok := stack.Ctx.MethodOf(name); ok {
+			return method
+		}
+		if stack.Options.Strict {
+			panic(newMissing("undefined identifier %s", name).at(expr))
+		}
+		return nil
+	}
+}
+
+func compileUnary(expr *ast.UnaryExpr) evalFunc {
+	x := compileExpr(expr.X, PROPERTY)
+	op := expr.Op
+	untyped := isUntypedInt(expr.X)
+	return func(stack *Stack) any {
+		val := x(stack)
+		if !untyped && op != token.NOT && isTyped(&stack.Options, val, val) {
+			return evalTypedUnary(op, val, &stack.Options)
+		}
+		return evalUnary(op, val)
+	}
+}
+
+func compileCall(expr *ast.CallExpr) evalFunc {
+	var fun evalFunc
+	// a call through ?. is skipped when the receiver is nil
+	safe, isSafe := expr.Fun.(*SafeSelectorExpr)
+	if isSafe {
+		fun = compileExpr(safe.X, PROPERTY)
+	} else {
+		fun = compileExpr(expr.Fun, METHOD)
+	}
+	funcArgs := false
+	if ident, ok := expr.Fun.(*ast.Ident); ok {
+		funcArgs = higherOrder[ident.Name]
+	}
+	var args []evalFunc
+	for _, arg := range expr.Args {
+		if ident, ok := arg.(*ast.Ident); ok && funcArgs {
+			args = append(args, compileFuncRef(ident))
+		} else {
+			args = append(args, compileExpr(arg, PROPERTY))
+		}
+	}
+	spread := expr.Ellipsis.IsValid()
+	return func(stack *Stack) any {
+		val := fun(stack)
+		if isSafe {
+			if refx.IsNil(val) {
+				return nil
+			}
+			val, _ = memberOf(val, safe.Sel.Name, METHOD)
+		}
+		if val == nil {
+			panic(newError(KindUndefined, "undefined function %s", nameOf(expr.Fun)))
+		}
+		fn, isLambda := val.(*lambda)
+		method := refx.ValueOf(val)
+		if !isLambda {
+			if method.Kind() != reflect.Func {
+				panic(newError(KindTypeMismatch, "%s is not a function", nameOf(expr.Fun)))
+			}
+			if err := arityError(nameOf(expr.Fun), method.Type(), len(args), spread); err != nil {
+				panic(err)
+			}
+		}
+		var in []any
+		for _, arg := range args {
+			val := arg(stack)
+			if tmp, ok := val.(*lambda); ok {
+				val = tmp.bind(stack)
+			}
+			in = append(in, val)
+		}
+		if spread {
+			last := in[len(in)-1]
+			if !refx.IsNil(last) && !refx.IsList(last) {
+				panic(newError(KindTypeMismatch, "can't spread %s in call to %s", refx.TypeOf(last), nameOf(expr.Fun)))
+			}
+			in = append(in[:len(in)-1], refx.AsList(last)...)
+		}
+		if stack.limit != nil {
+			stack.limit.enter()
+			defer stack.limit.leave()
+		}
+		var ret any
+		if isLambda {
+			ret = fn.call(stack, in)
+		} else {
+			var err *EvalError
+			if ret, err = callOf(nameOf(expr.Fun), method, in); err != nil {
+				panic(err.at(expr))
+			}
+		}
+		if stack.limit != nil {
+			stack.limit.size(ret)
+		}
+		return ret
+	}
+}
+
+func arityError(name string, fnType reflect.Type, args int, spread bool) *EvalError {
+	if spread && !fnType.IsVariadic() {
+		return newError(KindArity, "can't spread arguments of non-variadic %s", name)
+	} else if spread && args != fnType.NumIn() ||
+		fnType.IsVariadic() && args < fnType.NumIn()-1 ||
+		!fnType.IsVariadic() && args != fnType.NumIn() {
+		return newError(KindArity, "%s expects %d arguments, got %d", name, fnType.NumIn(), args)
+	}
+	return nil
+}
+
+// callOf calls fn with args coerced to its parameters, a non-nil error as
+// the last of its results fails the call
+func callOf(name string, fn reflect.Value, args []any) (any, *EvalError) {
+	fnType := fn.Type()
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		param := paramOf(fnType, i)
+		val, ok := coerce(arg, param)
+		if !ok && isNumberKind(val.Kind()) && isNumberKind(param.Kind()) && !numberFits(val, param) {
+			return nil, newError(KindOverflow, "%v overflows %s in argument %d of %s", arg, param, i+1, name)
+		} else if !ok {
+			return nil, newError(KindTypeMismatch, "can't use %s as %s in argument %d of %s",
+				refx.TypeOf(arg), param, i+1, name)
+		}
+		in[i] = val
+	}
+	values := fn.Call(in)
+	if last := len(values) - 1; last >= 0 && fnType.Out(last) == errorType && !values[last].IsNil() {
+		return nil, newError(KindRuntime, "%s: %w", name, values[last].Interface().(error))
+	}
+	if len(values) > 0 {
+		return values[0].Interface(), nil
+	}
+	return nil, nil
+}
+
+func nameOf(expr ast.Expr) string {
+	switch tmp := expr.(type) {
+	case *ast.Ident:
+		return tmp.Name
+	case *ast.SelectorExpr:
+		return tmp.Sel.Name
+	case *SafeSelectorExpr:
+		return tmp.Sel.Name
+	}
+	return "function"
+}
+
+func paramOf(fn reflect.Type, i int) reflect.Type {
+	last := fn.NumIn() - 1
+	if fn.IsVariadic() && i >= last {
+		return fn.In(last).Elem()
+	} else if i <= last {
+		return fn.In(i)
+	}
+	return refx.TypeOf(&refx.TAny).Elem()
+}
+
+var errorType = refx.TypeOf((*error)(nil)).Elem()
+
+// coerce converts val to typ where refx.AsOf can do it without losing the
+// value: numbers between their kinds when they fit, strings and bools to
+// named types, and lists element by element
+func coerce(val any, typ reflect.Type) (reflect.Value, bool) {
+	value := refx.ValueOf(val)
+	if !value.IsValid() {
+		return reflect.Zero(typ), true
+	}
+	from := value.Type()
+	switch {
+	case from.AssignableTo(typ):
+		return value, true
+	case isNumberKind(from.Kind()) && isNumberKind(typ.Kind()):
+		if value.CanFloat() && !reflect.Zero(typ).CanFloat() {
+			num := value.Float()
+			if math.IsInf(num, 0) || num != math.Trunc(num) {
+				return value, false
+			}
+		}
+		if !numberFits(value, typ) {
+			return value, false
+		}
+		return refx.AsOf(typ, value.Interface()), true
+	case from.Kind() == typ.Kind() && (typ.Kind() == reflect.String || typ.Kind() == reflect.Bool):
+		return refx.AsOf(typ, value.Interface()), true
+	case typ.Kind() == reflect.Slice && (from.Kind() == reflect.Slice || from.Kind() == reflect.Array):
+		ret := reflect.MakeSlice(typ, value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			item, ok := coerce(value.Index(i).Interface(), typ.Elem())
+			if !ok {
+				return value, false
+			}
+			ret.Index(i).Set(item)
+		}
+		return ret, true
+	}
+	return value, false
+}
+
+// numberFits tells if the number value is in the range of the number type typ
+func numberFits(value reflect.Value, typ reflect.Type) bool {
+	zero := reflect.Zero(typ)
+	switch {
+	case !zero.CanFloat() && value.CanFloat():
+		if math.IsNaN(value.Float()) || math.IsInf(value.Float(), 0) {
+			return false
+		}
+		num, _ := big.NewFloat(value.Float()).Int(nil)
+		return fits(num, typ)
+	case !zero.CanFloat():
+		return fits(exactOf(value), typ)
+	case value.CanFloat():
+		return !zero.OverflowFloat(value.Float())
+	}
+	return true
+}
+
+// coercible is what coerce accepts as far as the types tell
+func coercible(from reflect.Type, to reflect.Type) bool {
+	switch {
+	case isDynamic(from), from.AssignableTo(to):
+		return true
+	case isNumberKind(from.Kind()) && isNumberKind(to.Kind()):
+		return true
+	case from.Kind() == to.Kind() && (to.Kind() == reflect.String || to.Kind() == reflect.Bool):
+		return true
+	case to.Kind() == reflect.Slice && (from.Kind() == reflect.Slice || from.Kind() == reflect.Array):
+		return coercible(from.Elem(), to.Elem())
+	}
+	return false
+}
+
+func compileBinary(expr *ast.BinaryExpr) evalFunc {
+	x := compileExpr(expr.X, PROPERTY)
+	y := compileExpr(expr.Y, PROPERTY)
+	op := expr.Op
+	lits := operandsOf(expr)
+	switch op {
+	case token.LOR:
+		return func(stack *Stack) any {
+			return refx.AsBool(x(stack)) || refx.AsBool(y(stack))
+		}
+	case token.LAND:
+		return func(stack *Stack) any {
+			return refx.AsBool(x(stack)) && refx.AsBool(y(stack))
+		}
+	case COALESCE:
+		return func(stack *Stack) any {
+			if left := x(stack); !refx.IsNil(left) {
+				return left
+			}
+			return y(stack)
+		}
+	case IN:
+		return func(stack *Stack) any {
+			return evalIn(x(stack), y(stack))
+		}
+	case token.EQL, token.NEQ, token.GTR, token.LSS, token.GEQ, token.LEQ:
+		return func(stack *Stack) any {
+			return evalCmpBool(op, x(stack), y(stack))
+		}
+	case token.ADD:
+		xs := compileString(expr.X)
+		ys := compileString(expr.Y)
+		return guard(expr, func(stack *Stack) any {
+			var ret any
+			if left := x(stack); refx.IsString(left) {
+				ret = refx.AsString(left) + ys(stack)
+			} else if right := y(stack); refx.IsString(right) {
+				ret = xs(stack) + refx.AsString(right)
+			} else {
+				return arithmeticOf(stack, op, left, right, lits)
+			}
+			if stack.limit != nil {
+				stack.limit.size(ret)
+			}
+			return ret
+		})
+	case token.SUB, token.MUL, token.QUO, token.REM:
+		return guard(expr, func(stack *Stack) any {
+			return arithmeticOf(stack, op, x(stack), y(stack), lits)
+		})
+	case token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
+		return guard(expr, func(stack *Stack) any {
+			left, right := x(stack), y(stack)
+			if stack.Options.Typed && isTyped(&stack.Options, left, right) {
+				return evalTyped(op, left, right, lits, &stack.Options)
+			}
+			return evalBitOpr(op, left, right)
+		})
+	}
+	return func(stack *Stack) any {
+		x(stack)
+		y(stack)
+		return nil
+	}
+}
+
+func compileCompositeLit(expr *ast.CompositeLit) evalFunc {
+	if _, ok := expr.Type.(*ast.MapType); ok {
+		var keys, values []evalFunc
+		for _, elt := range expr.Elts {
+			kv := elt.(*ast.KeyValueExpr)
+			keys = append(keys, compileExpr(kv.Key, PROPERTY))
+			values = append(values, compileExpr(kv.Value, PROPERTY))
+		}
+		return func(stack *Stack) any {
+			ret := make(map[string]any, len(keys))
+			for i, key := range keys {
+				ret[refx.AsString(key(stack))] = values[i](stack)
+			}
+			return ret
+		}
+	}
+	var elts []evalFunc
+	for _, elt := range expr.Elts {
+		elts = append(elts, compileExpr(elt, PROPERTY))
+	}
+	return func(stack *Stack) any {
+		ret := make([]any, len(elts))
+		for i, elt := range elts {
+			ret[i] = elt(stack)
+		}
+		return ret
+	}
+}
+
+func compileSlice(expr *ast.SliceExpr) evalFunc {
+	x := compileExpr(expr.X, PROPERTY)
+	var low, high evalFunc
+	if expr.Low != nil {
+		low = compileExpr(expr.Low, PROPERTY)
+	}
+	if expr.High != nil {
+		high = compileExpr(expr.High, PROPERTY)
+	}
+	return func(stack *Stack) any {
+		var lo, hi any
+		obj := x(stack)
+		if low != nil {
+			lo = low(stack)
+		}
+		if high != nil {
+			hi = high(stack)
+		}
+		return evalSlice(obj, lo, hi)
+	}
+}
+
+func compileCond(expr *CondExpr) evalFunc {
+	cond := compileExpr(expr.Cond, PROPERTY)
+	x := compileExpr(expr.X, PROPERTY)
+	y := compileExpr(expr.Y, PROPERTY)
+	return func(stack *Stack) any {
+		if refx.AsBool(cond(stack)) {
+			return x(stack)
+		}
+		return y(stack)
+	}
+}
+
+// lambda is the value of a LambdaExpr, it keeps the Context it was defined
+// in but runs with the options and limits of the stack calling it
+type lambda struct {
+	ctx    Context
+	params []string
+	body   evalFunc
+}
+
+func (it *lambda) call(stack *Stack, args []any) any {
+	scope := newChildScope(it.ctx)
+	for i, name := range it.params {
+		var arg any
+		if i < len(args) {
+			arg = args[i]
+		}
+		scope.bindValue(name, arg)
+	}
+	return it.body(stack.fork(scope))
+}
+
+// bind makes the lambda a function called with stack, the way it is handed
+// to a Go function or returned from an evaluation
+func (it *lambda) bind(stack *Stack) func(args ...any) any {
+	return func(args ...any) any {
+		return it.call(stack, args)
+	}
+}
+
+// isCallable tells if val is a function or a lambda
+func isCallable(val any) bool {
+	if _, ok := val.(*lambda); ok {
+		return true
+	}
+	return refx.IsFunc(val)
+}
+
+func compileLambda(expr *LambdaExpr) evalFunc {
+	body := compileExpr(expr.Body, PROPERTY)
+	var params []string
+	for _, param := range expr.Params {
+		params = append(params, param.Name)
+	}
+	return func(stack *Stack) any {
+		return &lambda{ctx: stack.Ctx, params: params, body: body}
+	}
+}
+
+// compileString compiles the operand of a string concatenation, nested
+// additions are joined as strings instead of being summed
+func compileString(input ast.Expr) func(stack *Stack) string {
+	if expr, ok := input.(*ast.BinaryExpr); ok && expr.Op == token.ADD {
+		left := compileString(expr.X)
+		right := compileString(expr.Y)
+		return func(stack *Stack) string {
+			return left(stack) + right(stack)
+		}
+	}
+	val := compileExpr(input, PROPERTY)
+	return func(stack *Stack) string {
+		return stringOf(val(stack))
+	}
+}
@@ -0,0 +1,105 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	prog, err := Compile("user.age * 2 + 1")
+	assert.Equal(t, nil, err)
+	for i := 0; i < 3; i++ {
+		ret, err := prog.Run(NewScope(map[string]any{
+			"user": map[string]any{"age": i},
+		}))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, int64(i*2+1), ret)
+	}
+
+	_, err = Compile("user.")
+	assert.NotEqual(t, nil, err)
+
+	ret, err := MustCompile("a.b.c").Run(NewScope(map[string]any{
+		"a": map[string]any{"b": map[string]any{"c": "deep"}},
+	}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "deep", ret)
+
+	ret, err = MustCompile("getName0()").Run(nil)
+	assert.Equal(t, nil, ret)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestEval_CachedProgram(t *testing.T) {
+	scope := NewScope(map[string]any{"n": 2}).SetCache(NewCache(10))
+	for i := 0; i < 2; i++ {
+		ret, err := scope.Eval("n * 3")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, int64(6), ret)
+		ret, err = scope.Exec("m = n + 1; m * 2")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, int64(6), ret)
+	}
+	ae, _ := scope.CacheOf("n * 3")
+	expr, ok := ae.(*compiledExpr)
+	assert.True(t, ok)
+	prog, err := programOf("n * 3", scope)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, reflect.ValueOf(expr.eval).Pointer(), reflect.ValueOf(prog.eval).Pointer())
+	ae, _ = scope.CacheOf(scriptKey + "m = n + 1; m * 2")
+	_, ok = ae.(*compiledExpr)
+	assert.True(t, ok)
+
+	// Check reads the parsed expression of a compiled one from the cache
+	_, err = Eval("cached * 3", NewScope(map[string]any{"cached": 1}))
+	assert.Equal(t, nil, err)
+	tp, err := Check("cached * 3", map[string]any{"cached": 1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, reflect.TypeOf(int64(0)), tp)
+}
+
+func TestProgram_RunConcurrent(t *testing.T) {
+	prog := MustCompile("'id-' + id")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			ret, err := prog.Run(NewScope(map[string]any{"id": id}))
+			assert.Equal(t, nil, err)
+			assert.Equal(t, "id-"+strconv.Itoa(id), ret)
+		}(i)
+	}
+	wg.Wait()
+}
+
+var benchExpr = "order.price * order.count > 100 && order.user.name == 'Allen'"
+
+func benchScope() *Scope {
+	return NewScope(map[string]any{
+		"order": map[string]any{
+			"price": 12.5,
+			"count": 10,
+			"user":  map[string]any{"name": "Allen"},
+		},
+	})
+}
+
+func BenchmarkEval(b *testing.B) {
+	scope := benchScope()
+	for i := 0; i < b.N; i++ {
+		Eval(benchExpr, scope)
+	}
+}
+
+func BenchmarkProgram_Run(b *testing.B) {
+	scope := benchScope()
+	prog := MustCompile(benchExpr)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		prog.Run(scope)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/avicd/go-utilx/bufx"
 	"github.com/avicd/go-utilx/refx"
 	"go/ast"
+	"sync"
 )
 
 type Context interface {
@@ -13,28 +14,48 @@ type Context interface {
 	Cache(text string, expr ast.Expr)
 }
 
+// Scope is safe for concurrent use, its maps are guarded by mu and vars is
+// replaced rather than modified, so a reader may range over a copy of it
 type Scope struct {
+	mu      sync.RWMutex
 	binds   map[string]any
 	backup  map[string]any
 	callers map[string]any
 	vars    []any
+	parent  Context
+	cache   *Cache
 }
 
 var top *Scope
-var topCache bufx.Cache[string, ast.Expr]
+var topCache = NewCache(1000)
 
 func init() {
-	top = NewScope()
-	topCache = &bufx.LruCache[string, ast.Expr]{Size: 1000}
+	top = newTopScope()
 }
 
+func newTopScope() *Scope {
+	scope := NewScope()
+	for name, fn := range Builtins() {
+		scope.Bind(name, fn)
+	}
+	return scope
+}
+
+// SetCacheSize replaces the store of the DefaultCache with an empty one of
+// size, it is safe to call while expressions are evaluated
 func SetCacheSize(size int) {
-	topCache = &bufx.LruCache[string, ast.Expr]{Size: size}
+	topCache.setStore(&bufx.LruCache[string, ast.Expr]{Size: size})
 }
 
+// DefaultCache is used by the scopes without a cache of their own
+func DefaultCache() *Cache {
+	return topCache
+}
+
+// TopScope is the parent of every scope, it holds the Builtins
 func TopScope() *Scope {
 	if top == nil {
-		top = NewScope()
+		top = newTopScope()
 	}
 	return top
 }
@@ -48,48 +69,133 @@ func NewScope(vars ...any) *Scope {
 	}
 }
 
-func (it *Scope) ValueOf(ident string) (any, bool) {
-	if val, ok := refx.PropOfId(it.binds, ident); ok {
+// newChildScope leaves the maps of the scope to be made on its first Bind
+func newChildScope(parent Context) *Scope {
+	return &Scope{parent: parent}
+}
+
+// Child creates a scope over it, what is bound on the child stays there
+// while anything else is looked up in it
+func (it *Scope) Child() *Scope {
+	return newChildScope(it)
+}
+
+// parentOf is the Context consulted for anything the scope can't resolve
+func (it *Scope) parentOf() Context {
+	if it.parent != nil {
+		return it.parent
+	} else if !it.IsTop() {
+		return TopScope()
+	}
+	return nil
+}
+
+func (it *Scope) localValueOf(ident string) (any, bool) {
+	it.mu.RLock()
+	val, ok := it.binds[ident]
+	if !ok {
+		val, ok = refx.PropOfId(it.binds, ident)
+	}
+	vars := it.vars
+	it.mu.RUnlock()
+	if ok {
 		return val, true
 	}
-	for _, obj := range it.vars {
+	for _, obj := range vars {
 		if val, ok := refx.PropOfId(obj, ident); ok {
 			return val, true
 		}
 	}
-	if !it.IsTop() {
-		return TopScope().ValueOf(ident)
+	return nil, false
+}
+
+func (it *Scope) ValueOf(ident string) (any, bool) {
+	if val, ok := it.localValueOf(ident); ok {
+		return val, true
+	}
+	if parent := it.parentOf(); parent != nil {
+		return parent.ValueOf(ident)
 	}
 	return nil, false
 }
 
 func (it *Scope) MethodOf(ident string) (any, bool) {
-	for _, obj := range it.vars {
+	it.mu.RLock()
+	vars := it.vars
+	method, ok := it.callers[ident]
+	it.mu.RUnlock()
+	for _, obj := range vars {
 		if method, ok := refx.MethodOfId(obj, ident); ok {
 			return method, true
 		}
 	}
-	if method, ok := it.callers[ident]; ok {
+	if ok {
 		return method, true
-	} else if !it.IsTop() {
-		return TopScope().MethodOf(ident)
+	}
+	// functions held by the scope's own values shadow the builtins
+	if val, ok := it.localValueOf(ident); ok && isCallable(val) {
+		return val, true
+	}
+	if parent := it.parentOf(); parent != nil {
+		return parent.MethodOf(ident)
 	}
 	return nil, false
 }
 
+// SetCache makes the scope and its child scopes keep their expressions in
+// cache instead of the DefaultCache, a nil cache restores the default
+func (it *Scope) SetCache(cache bufx.Cache[string, ast.Expr]) *Scope {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if cache == nil {
+		it.cache = nil
+	} else {
+		it.cache = WrapCache(cache)
+	}
+	return it
+}
+
+func (it *Scope) exprCache() *Cache {
+	it.mu.RLock()
+	cache := it.cache
+	it.mu.RUnlock()
+	if cache != nil {
+		return cache
+	} else if parent, ok := it.parent.(*Scope); ok {
+		return parent.exprCache()
+	}
+	return topCache
+}
+
+func (it *Scope) CacheStats() CacheStats {
+	return it.exprCache().Stats()
+}
+
 func (it *Scope) CacheOf(text string) (ast.Expr, bool) {
-	return topCache.Get(text)
+	return it.exprCache().Get(text)
 }
 
 func (it *Scope) Cache(text string, expr ast.Expr) {
-	topCache.Put(text, expr)
+	it.exprCache().Put(text, expr)
 }
 
 func (it *Scope) IsTop() bool {
 	return it == top
 }
 
+// maps makes the maps of a child scope, it is called with mu locked
+func (it *Scope) maps() {
+	if it.binds == nil {
+		it.binds = map[string]any{}
+		it.backup = map[string]any{}
+		it.callers = map[string]any{}
+	}
+}
+
 func (it *Scope) Bind(name string, value any) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.maps()
 	if refx.IsFunc(value) {
 		it.callers[name] = value
 	} else {
@@ -97,23 +203,63 @@ func (it *Scope) Bind(name string, value any) {
 	}
 }
 
+// bindValue binds value as a value even if it is a function, the way the
+// parameters of a lambda are bound
+func (it *Scope) bindValue(name string, value any) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.maps()
+	it.binds[name] = value
+}
+
+// boundOf is the value or function bound to name on the scope itself
+func (it *Scope) boundOf(name string) (any, bool) {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	if val, ok := it.binds[name]; ok {
+		return val, true
+	}
+	val, ok := it.callers[name]
+	return val, ok
+}
+
+// UnBind removes the value or the function bound to name, as Bind keeps
+// functions apart from values
 func (it *Scope) UnBind(name string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
 	delete(it.binds, name)
+	delete(it.callers, name)
 }
 
 func (it *Scope) Backup(name string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
 	if val, ok := it.binds[name]; ok {
 		it.backup[name] = val
 	}
 }
 
 func (it *Scope) Restore(name string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
 	if val, ok := it.backup[name]; ok {
 		it.binds[name] = val
 		delete(it.backup, name)
 	}
 }
 
+// snapshot copies the binds and vars of the scope
+func (it *Scope) snapshot() (map[string]any, []any) {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	binds := map[string]any{}
+	for key, val := range it.binds {
+		binds[key] = val
+	}
+	return binds, it.vars
+}
+
 func (it *Scope) Merge(val any) *Scope {
 	var binds any
 	var vars []any
@@ -121,18 +267,19 @@ func (it *Scope) Merge(val any) *Scope {
 	switch tmp := val.(type) {
 	case *Scope:
 		if tmp != nil {
-			binds = tmp.binds
-			vars = tmp.vars
+			binds, vars = tmp.snapshot()
 		}
 	case Scope:
-		binds = tmp.binds
-		vars = tmp.vars
+		binds, vars = tmp.snapshot()
 	default:
 		binds = val
 	}
 	if binds != nil {
-		if refx.IndirectType(binds) == refx.TypeOf(it.binds) {
+		if refx.IndirectType(binds) == refx.TypeOf(map[string]any{}) {
+			it.mu.Lock()
+			it.maps()
 			refx.Merge(&it.binds, binds)
+			it.mu.Unlock()
 		} else {
 			it.Link(val)
 		}
@@ -147,6 +294,8 @@ func (it *Scope) Link(items ...any) *Scope {
 	if len(items) < 1 {
 		return it
 	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
 	var dest []any
 	dest = append(dest, items...)
 	dest = append(dest, it.vars...)
@@ -155,20 +304,27 @@ func (it *Scope) Link(items ...any) *Scope {
 }
 
 func (it *Scope) UnLink(obj any) *Scope {
-	index := -1
+	it.mu.Lock()
+	defer it.mu.Unlock()
 	for i, p := range it.vars {
 		if p == obj {
-			index = i
+			var dest []any
+			dest = append(dest, it.vars[:i]...)
+			it.vars = append(dest, it.vars[i+1:]...)
 			break
 		}
 	}
-	if index > -1 {
-		vars := it.vars[:index]
-		it.vars = append(vars, it.vars[index+1:])
-	}
 	return it
 }
 
 func (it *Scope) Eval(text string) (any, error) {
 	return Eval(text, it)
 }
+
+func (it *Scope) EvalWith(text string, opts EvalOptions) (any, error) {
+	return EvalWith(text, it, opts)
+}
+
+func (it *Scope) Exec(text string) (any, error) {
+	return Exec(text, it)
+}
@@ -0,0 +1,123 @@
+package evalx
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestScope_Child(t *testing.T) {
+	parent := NewScope(map[string]any{"rate": 2})
+	parent.Bind("name", "parent")
+	parent.Bind("double", func(n int64) int64 { return n * 2 })
+	child := parent.Child()
+	child.Bind("name", "child")
+	child.Bind("qty", 3)
+
+	ret, err := child.Eval("name + ':' + double(qty * rate)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "child:12", ret)
+	ret, err = parent.Eval("name + ':' + (qty ?? 0)")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "parent:0", ret)
+
+	_, err = child.Exec("name = 'changed'\ntotal = 1")
+	assert.Equal(t, nil, err)
+	ret, _ = parent.Eval("name")
+	assert.Equal(t, "parent", ret)
+	ret, _ = parent.Eval("total")
+	assert.Equal(t, nil, ret)
+
+	child.UnBind("name")
+	ret, _ = child.Eval("len(name)")
+	assert.Equal(t, 6, ret)
+}
+
+func TestScope_Merge(t *testing.T) {
+	type item struct {
+		Val int
+	}
+	src := NewScope(&item{1})
+	src.Bind("a", 1)
+	scope := NewScope().Merge(src).Merge(Scope{binds: map[string]any{"b": 2}, vars: []any{map[string]any{"c": 3}}})
+	ret, err := scope.Eval("a + b + c + Val")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(7), ret)
+
+	scope.Bind("inc", func(n int64) int64 { return n + 1 })
+	ret, _ = scope.Eval("inc(a)")
+	assert.Equal(t, int64(2), ret)
+	scope.UnBind("inc")
+	scope.UnBind("a")
+	_, err = scope.Eval("inc(1)")
+	assert.NotEqual(t, nil, err)
+	ret, _ = scope.Eval("a")
+	assert.Equal(t, nil, ret)
+}
+
+func TestScope_UnLink(t *testing.T) {
+	type item struct {
+		Val int
+	}
+	a, b, c := &item{1}, &item{2}, &item{3}
+	scope := NewScope(a, b, c)
+	scope.UnLink(a)
+	scope.UnLink(b)
+	ret, err := scope.Eval("Val")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, ret)
+}
+
+func TestScope_Concurrent(t *testing.T) {
+	shared := NewScope(map[string]any{"base": 100})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				child := shared.Child()
+				child.Bind("n", n)
+				ret, err := child.Exec("x = base + n\nfor i in [1, 2] { x = x + i }\nx")
+				assert.Equal(t, nil, err)
+				assert.Equal(t, int64(103+n), ret)
+				name := fmt.Sprintf("v%d", n)
+				shared.Bind(name, j)
+				shared.Link(map[string]any{name: j})
+				shared.UnBind(name)
+				shared.Backup("base")
+				shared.Restore("base")
+			}
+		}(i)
+	}
+	wg.Wait()
+	ret, _ := shared.Eval("base")
+	assert.Equal(t, 100, ret)
+}
+
+func TestScope_FuncNames(t *testing.T) {
+	inc := func(n int64) int64 { return n + 1 }
+	scope := NewScope(map[string]any{"list": []any{"b", "a"}, "fns": []any{inc}})
+	scope.Bind("twice", func(n int64) int64 { return n * 2 })
+	cases := map[string]any{
+		"first ?? 'dflt'":            "dflt",
+		"twice ?? 'dflt'":            "dflt",
+		"(string ?? '') + 'x'":       "x",
+		"twice(21)":                  int64(42),
+		"map(list, upper)":           []any{"B", "A"},
+		"map([1, 2], twice)":         []any{int64(2), int64(4)},
+		"map(fns, f -> f(2))":        []any{int64(3)},
+		"map(fns, f -> f)[0] != nil": true,
+		"[twice][0]":                 nil,
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+	_, err := scope.EvalWith("values == nil", EvalOptions{Strict: true})
+	assert.Equal(t, KindUndefined, err.(*EvalError).Kind)
+	_, err = scope.EvalWith("map(list, uper)", EvalOptions{Strict: true})
+	assert.Equal(t, KindUndefined, err.(*EvalError).Kind)
+}
@@ -0,0 +1,165 @@
+package evalx
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+type ErrorKind uint
+
+const (
+	KindRuntime ErrorKind = iota
+	KindSyntax
+	KindUndefined
+	KindTypeMismatch
+	KindDivisionByZero
+	KindArity
+	KindLimit
+	KindOverflow
+)
+
+var kindNames = map[ErrorKind]string{
+	KindRuntime:        "runtime error",
+	KindSyntax:         "syntax error",
+	KindUndefined:      "undefined",
+	KindTypeMismatch:   "type mismatch",
+	KindDivisionByZero: "division by zero",
+	KindArity:          "bad call arity",
+	KindLimit:          "limit exceeded",
+	KindOverflow:       "integer overflow",
+}
+
+func (kind ErrorKind) String() string {
+	if name, ok := kindNames[kind]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorKind(%d)", kind)
+}
+
+// EvalError locates a failure in an expression, Pos is the position of the
+// failing node as reported by go/token, Offset, Line and Column are resolved
+// against Expr
+type EvalError struct {
+	Kind   ErrorKind
+	Expr   string
+	Node   string
+	Pos    token.Pos
+	End    token.Pos
+	Offset int
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *EvalError) Error() string {
+	msg := e.Kind.String()
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("evalx: %d:%d: %s", e.Line, e.Column, msg)
+	}
+	return "evalx: " + msg
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// ErrMissing is matched by the KindUndefined errors of an identifier,
+// member or index that doesn't resolve, unlike an undefined function
+var ErrMissing = errors.New("missing value")
+
+type missingError struct {
+	error
+}
+
+func (missingError) Is(target error) bool {
+	return target == ErrMissing
+}
+
+func (e missingError) Unwrap() error {
+	return e.error
+}
+
+func newError(kind ErrorKind, format string, args ...any) *EvalError {
+	return &EvalError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// newMissing is the KindUndefined error of a value that doesn't resolve
+func newMissing(format string, args ...any) *EvalError {
+	return &EvalError{Kind: KindUndefined, Err: missingError{fmt.Errorf(format, args...)}}
+}
+
+func (e *EvalError) at(node ast.Node) *EvalError {
+	e.Pos = node.Pos()
+	e.End = node.End()
+	return e
+}
+
+func asEvalError(val any) *EvalError {
+	var ee *EvalError
+	switch tmp := val.(type) {
+	case *EvalError:
+		return tmp
+	case error:
+		if errors.As(tmp, &ee) {
+			return ee
+		}
+		return &EvalError{Kind: KindRuntime, Err: tmp}
+	}
+	return &EvalError{Kind: KindRuntime, Err: fmt.Errorf("%v", val)}
+}
+
+// guard attributes a failure inside fn to node, unless a nested node has
+// already claimed it
+func guard(node ast.Node, fn evalFunc) evalFunc {
+	return func(stack *Stack) any {
+		defer func() {
+			if rc := recover(); rc != nil {
+				ee := asEvalError(rc)
+				if !ee.Pos.IsValid() {
+					ee.Pos = node.Pos()
+					ee.End = node.End()
+				}
+				panic(ee)
+			}
+		}()
+		return fn(stack)
+	}
+}
+
+// locate resolves the position of the error against the source text
+func (e *EvalError) locate(src string, root ast.Node) *EvalError {
+	if !e.Pos.IsValid() && root != nil {
+		e.Pos = root.Pos()
+		e.End = root.End()
+	}
+	e.Expr = src
+	e.Offset = int(e.Pos) - 1
+	if e.Offset < 0 || e.Offset > len(src) {
+		e.Offset = -1
+		return e
+	}
+	head := src[:e.Offset]
+	e.Line = strings.Count(head, "\n") + 1
+	e.Column = e.Offset - strings.LastIndex(head, "\n")
+	if end := int(e.End) - 1; end > e.Offset && end <= len(src) {
+		e.Node = src[e.Offset:end]
+	}
+	return e
+}
+
+func syntaxError(src string, err error) error {
+	ee := &EvalError{Kind: KindSyntax, Err: err}
+	var list scanner.ErrorList
+	if errors.As(err, &list) && len(list) > 0 {
+		ee.Err = errors.New(list[0].Msg)
+		ee.Pos = token.Pos(list[0].Pos.Offset + 1)
+	}
+	return ee.locate(src, nil)
+}
@@ -0,0 +1,47 @@
+package evalx
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvalError(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"a":     10,
+		"zero":  0,
+		"upper": func(s string) string { return s },
+	})
+	cases := []struct {
+		text   string
+		kind   ErrorKind
+		column int
+		node   string
+	}{
+		{"a + a / zero", KindDivisionByZero, 5, "a / zero"},
+		{"1.5 / 0", KindDivisionByZero, 1, "1.5 / 0"},
+		{"a +\n  missing(1)", KindUndefined, 3, "missing(1)"},
+		{"upper('a', 'b')", KindArity, 1, "upper('a', 'b')"},
+		{"upper(a)", KindTypeMismatch, 1, "upper(a)"},
+		{"1 + -'x'", KindTypeMismatch, 5, "-'x'"},
+		{"a +* 2", KindSyntax, 4, ""},
+	}
+	for _, c := range cases {
+		_, err := scope.Eval(c.text)
+		var ee *EvalError
+		assert.Equal(t, true, errors.As(err, &ee), c.text)
+		if ee == nil {
+			continue
+		}
+		assert.Equal(t, c.kind, ee.Kind, c.text)
+		assert.Equal(t, c.column, ee.Column, c.text)
+		assert.Equal(t, c.node, ee.Node, c.text)
+	}
+
+	_, err := scope.Eval("a +\n  missing(1)")
+	var ee *EvalError
+	errors.As(err, &ee)
+	assert.Equal(t, 2, ee.Line)
+	assert.Equal(t, 6, ee.Offset)
+	assert.Equal(t, "evalx: 2:3: undefined function missing", err.Error())
+}
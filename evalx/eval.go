@@ -2,233 +2,58 @@ package evalx
 
 import (
 	"errors"
-	"fmt"
 	"github.com/avicd/go-utilx/conv"
 	"github.com/avicd/go-utilx/refx"
 	"github.com/avicd/go-utilx/tokx"
 	"go/ast"
-	"go/parser"
 	"go/token"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func Eval(text string, cts ...Context) (any, error) {
-	text = strings.TrimSpace(text)
-	if text == "" {
-		return nil, errors.New("empty expression")
+	var ctx Context
+	if len(cts) > 0 {
+		ctx = cts[0]
 	}
-	expr := tokx.DoubleQuota(text)
-	var stack *Stack
-	if len(cts) > 0 && cts[0] != nil {
-		stack = StackOf(cts[0])
-	} else {
-		stack = StackOf(NewScope())
-	}
-	var astExpr ast.Expr
-	if ae, ok := stack.Ctx.CacheOf(expr); ok {
-		astExpr = ae
-	} else {
-		var err error
-		astExpr, err = parser.ParseExpr(expr)
-		if err != nil {
-			return nil, err
-		} else {
-			stack.Ctx.Cache(expr, astExpr)
-		}
-	}
-	val := evalExpr(astExpr, stack)
-	if stack.Error != nil {
-		return nil, stack.Error
-	}
-	return val, nil
+	return EvalWith(text, ctx, EvalOptions{})
 }
 
-func evalExpr(buf ast.Expr, stack *Stack) any {
-	defer func() {
-		rc := recover()
-		if rc != nil {
-			stack.Error = refx.AsError(rc)
-		}
-	}()
-	switch expr := buf.(type) {
-	case *ast.SelectorExpr:
-		return evalSelector(expr, stack)
-	case *ast.Ident:
-		return evalIdent(expr, stack, false)
-	case *ast.BasicLit:
-		return evalBasicLit(expr)
-	case *ast.UnaryExpr:
-		return evalUnary(expr, stack)
-	case *ast.ParenExpr:
-		return evalExpr(expr.X, stack)
-	case *ast.IndexExpr:
-		return evalIndex(expr, stack)
-	case *ast.CallExpr:
-		return evalCall(expr, stack)
-	case *ast.BinaryExpr:
-		return evalBinary(expr, stack)
-	}
-	return nil
+func srcOf(text string) string {
+	return tokx.DoubleQuota(strings.TrimSpace(text))
 }
 
-func evalSelector(expr *ast.SelectorExpr, stack *Stack) any {
-	target := stack.PopTarget()
-	var parent any
-	switch exprX := expr.X.(type) {
-	case *ast.SelectorExpr:
-		return evalSelector(exprX, stack)
-	case *ast.Ident:
-		parent = evalIdent(exprX, stack, true)
-	default:
-		parent = evalExpr(expr.X, stack)
+// programOf compiles text, or takes the closures compiled by an earlier
+// evaluation of it from the cache of ctx
+func programOf(text string, ctx Context) (*Program, error) {
+	src := srcOf(text)
+	if src == "" {
+		return nil, &EvalError{Kind: KindSyntax, Err: errors.New("empty expression"), Offset: -1}
 	}
-	if parent != nil {
-		if target == METHOD {
-			if method, ok := refx.MethodOf(parent, expr.Sel.Name); ok {
-				return method
-			}
-		}
-		if val, ok := refx.PropOf(parent, expr.Sel.Name); ok {
-			if target == METHOD {
-				if refx.IsFunc(val) {
-					return val
-				}
-			} else {
-				return val
-			}
-		}
-	}
-	return nil
+	return cachedProgram(ctx, text, src, func() (ast.Expr, error) {
+		return ParseExpr(src)
+	})
 }
 
-func evalIndex(expr *ast.IndexExpr, stack *Stack) any {
-	target := stack.PopTarget()
-	obj := evalExpr(expr.X, stack)
-	index := evalExpr(expr.Index, stack)
-	if target == METHOD {
-		if method, ok := refx.MethodOf(obj, index); ok {
-			return method
-		}
-	}
-	if val, ok := refx.PropOf(obj, index); ok {
-		if target == METHOD {
-			if refx.IsFunc(val) {
-				return val
-			}
-		} else {
-			return val
-		}
-	}
-	return nil
-}
-
-func evalIdent(expr *ast.Ident, stack *Stack, sel bool) any {
-	target := stack.PopTarget()
-	if !sel {
-		switch expr.Name {
-		case "nil", "null":
-			return nil
-		case "true":
-			return true
-		case "false":
-			return false
-		}
-	}
-	if target == METHOD {
-		if method, ok := stack.Ctx.MethodOf(expr.Name); ok {
-			return method
-		}
+func exprOf(text string, ctx Context) (ast.Expr, error) {
+	src := srcOf(text)
+	if src == "" {
+		return nil, &EvalError{Kind: KindSyntax, Err: errors.New("empty expression"), Offset: -1}
 	}
-	if val, ok := stack.Ctx.ValueOf(expr.Name); ok {
-		if target == METHOD {
-			if refx.IsFunc(val) {
-				return val
-			}
-		} else {
-			return val
+	if ae, ok := ctx.CacheOf(src); ok {
+		if tmp, ok := ae.(*compiledExpr); ok {
+			return tmp.Expr, nil
 		}
+		return ae, nil
 	}
-	return nil
-}
-
-func evalUnary(expr *ast.UnaryExpr, stack *Stack) any {
-	ret := evalExpr(expr.X, stack)
-	switch expr.Op {
-	case token.NOT:
-		return !refx.AsBool(ret)
-	case token.SUB:
-		if refx.IsInteger(ret) {
-			return -refx.AsInt64(ret)
-		} else if refx.IsUInteger(ret) {
-			return -refx.AsUint64(ret)
-		} else if refx.IsFloat(ret) {
-			return -refx.AsFloat64(ret)
-		} else {
-			panic(fmt.Errorf("evalx: invalid operator '%s' on %v", expr.Op, expr.X))
-		}
-	case token.ADD:
-		if refx.IsNumber(ret) {
-			panic(fmt.Errorf("evalx: invalid operator '%s' on %v", expr.Op, expr.X))
-		}
+	astExpr, err := ParseExpr(src)
+	if err != nil {
+		return nil, syntaxError(strings.TrimSpace(text), err)
 	}
-	return ret
-}
-
-func evalCall(expr *ast.CallExpr, stack *Stack) any {
-	stack.PushTarget(METHOD)
-	val := evalExpr(expr.Fun, stack)
-	if val == nil {
-		panic(fmt.Errorf("evalx: invalid function"))
-		return nil
-	}
-	method := refx.ValueOf(val)
-	var args []reflect.Value
-	for _, buf := range expr.Args {
-		argVal := evalExpr(buf, stack)
-		args = append(args, refx.ValueOf(argVal))
-	}
-	values := method.Call(args)
-	if len(values) > 0 {
-		return values[0].Interface()
-	}
-	return nil
-}
-
-func evalBinary(expr *ast.BinaryExpr, stack *Stack) any {
-	left := evalExpr(expr.X, stack)
-	if expr.Op == token.LOR && refx.AsBool(left) {
-		return true
-	}
-	var right any
-	if expr.Op == token.ADD {
-		if refx.IsString(left) {
-			right = evalString(expr.Y, stack)
-		} else {
-			right = evalExpr(expr.Y, stack)
-			if refx.IsString(right) {
-				left = evalString(expr.X, stack)
-			}
-		}
-	} else {
-		right = evalExpr(expr.Y, stack)
-	}
-	stack.X = left
-	stack.Y = right
-	var ret any
-	switch expr.Op {
-	case token.LOR:
-		ret = refx.AsBool(right)
-	case token.LAND:
-		ret = refx.AsBool(left) && refx.AsBool(right)
-	case token.EQL, token.NEQ, token.GTR, token.LSS, token.GEQ, token.LEQ:
-		ret = evalCmpBool(expr, left, right)
-	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM:
-		ret = evalArithmetic(expr, stack)
-	case token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT:
-		ret = evalBitOpr(expr, stack)
-	}
-	return ret
+	ctx.Cache(src, astExpr)
+	return astExpr, nil
 }
 
 func evalBasicLit(expr *ast.BasicLit) any {
@@ -240,27 +65,52 @@ func evalBasicLit(expr *ast.BasicLit) any {
 	case token.INT:
 		return conv.ParseInt(expr.Value)
 	case token.FLOAT:
-		return conv.ParseFloat(expr.Value)
+		// a go float literal, which may start with '.' like .5
+		num, _ := strconv.ParseFloat(strings.ReplaceAll(expr.Value, "_", ""), 64)
+		return num
 	default:
 		return nil
 	}
 }
 
-func evalString(input ast.Expr, stack *Stack) string {
-	if expr, ok := input.(*ast.BinaryExpr); ok {
-		if expr.Op == token.ADD {
-			left := evalString(expr.X, stack)
-			right := evalString(expr.Y, stack)
-			return left + right
+func evalUnary(op token.Token, ret any) any {
+	switch op {
+	case token.NOT:
+		return !refx.AsBool(ret)
+	case token.SUB:
+		if d, ok := ret.(time.Duration); ok {
+			return -d
+		} else if isBig(ret) {
+			return negBig(ret)
+		} else if refx.IsInteger(ret) {
+			return -refx.AsInt64(ret)
+		} else if refx.IsUInteger(ret) {
+			return -refx.AsUint64(ret)
+		} else if refx.IsFloat(ret) {
+			return -refx.AsFloat64(ret)
+		} else {
+			panic(newError(KindTypeMismatch, "invalid operator '%s' on %v", op, ret))
+		}
+	case token.XOR:
+		if refx.IsInteger(ret) {
+			return ^refx.AsInt64(ret)
+		} else if refx.IsUInteger(ret) {
+			return ^refx.AsUint64(ret)
+		} else {
+			panic(newError(KindTypeMismatch, "invalid operator '%s' on %v", op, ret))
+		}
+	case token.ADD:
+		if !isNumeric(ret) {
+			panic(newError(KindTypeMismatch, "invalid operator '%s' on %v", op, ret))
 		}
 	}
-	return refx.AsString(evalExpr(input, stack))
+	return ret
 }
 
-func evalCmpBool(expr *ast.BinaryExpr, x, y any) bool {
+func evalCmpBool(op token.Token, x, y any) bool {
 	var ret bool
 	cmp := refx.Cmp(x, y)
-	switch expr.Op {
+	switch op {
 	case token.EQL:
 		ret = cmp == refx.CmpEq
 	case token.NEQ:
@@ -277,33 +127,39 @@ func evalCmpBool(expr *ast.BinaryExpr, x, y any) bool {
 	return ret
 }
 
-func evalArithmetic(expr *ast.BinaryExpr, stack *Stack) any {
+func evalArithmetic(op token.Token, x, y any) any {
 	var ret any
-	x := stack.X
-	y := stack.Y
-	if expr.Op == token.ADD && (refx.IsString(x) || refx.IsString(y)) {
+	if op == token.ADD && (refx.IsString(x) || refx.IsString(y)) {
 		return refx.AsString(x) + refx.AsString(y)
 	}
+	if isBig(x) || isBig(y) {
+		return evalBig(op, x, y, &EvalOptions{})
+	}
 	if refx.IsNumber(x) && refx.IsNumber(y) {
 		if refx.IsGeneralInt(x) && refx.IsGeneralInt(y) {
 			a := refx.AsInt64(x)
 			b := refx.AsInt64(y)
-			switch expr.Op {
+			switch op {
 			case token.ADD:
 				ret = a + b
 			case token.SUB:
 				ret = a - b
 			case token.MUL:
 				ret = a * b
-			case token.QUO:
-				ret = a / b
-			case token.REM:
-				ret = a % b
+			case token.QUO, token.REM:
+				if b == 0 {
+					panic(newError(KindDivisionByZero, "integer division by zero"))
+				}
+				if op == token.QUO {
+					ret = a / b
+				} else {
+					ret = a % b
+				}
 			}
 		} else {
 			a := refx.AsFloat64(x)
 			b := refx.AsFloat64(y)
-			switch expr.Op {
+			switch op {
 			case token.ADD:
 				ret = a + b
 			case token.SUB:
@@ -311,23 +167,24 @@ func evalArithmetic(expr *ast.BinaryExpr, stack *Stack) any {
 			case token.MUL:
 				ret = a * b
 			case token.QUO:
+				if b == 0 {
+					panic(newError(KindDivisionByZero, "float division by zero"))
+				}
 				ret = a / b
 			case token.REM:
-				panic(fmt.Errorf("evalx: invalid operator '%s' on float", expr.Op))
+				panic(newError(KindTypeMismatch, "invalid operator '%s' on float", op))
 			}
 		}
 	}
 	return ret
 }
 
-func evalBitOpr(expr *ast.BinaryExpr, stack *Stack) any {
+func evalBitOpr(op token.Token, x, y any) any {
 	var val uint64
-	x := stack.X
-	y := stack.Y
 	if refx.IsGeneralInt(x) && refx.IsGeneralInt(y) {
 		a := refx.AsUint64(x)
 		b := refx.AsUint64(y)
-		switch expr.Op {
+		switch op {
 		case token.AND:
 			val = a & b
 		case token.OR:
@@ -342,7 +199,86 @@ func evalBitOpr(expr *ast.BinaryExpr, stack *Stack) any {
 			val = a &^ b
 		}
 	} else {
-		panic(fmt.Errorf("evalx: bit operator work only on integer"))
+		panic(newError(KindTypeMismatch, "bit operator work only on integer"))
 	}
 	return val
 }
+
+// evalSlice slices lists by element and strings by rune, negative bounds
+// count from the end and out of range bounds are clamped
+func evalSlice(obj any, low any, high any) any {
+	if refx.IsNil(obj) {
+		return nil
+	}
+	var runes []rune
+	var list reflect.Value
+	var size int
+	isStr := refx.IsString(obj)
+	if isStr {
+		runes = []rune(refx.AsString(obj))
+		size = len(runes)
+	} else if refx.IsList(obj) {
+		list = refx.Indirect(obj)
+		size = list.Len()
+	} else {
+		panic(newError(KindTypeMismatch, "can't slice %s", refx.TypeOf(obj)))
+	}
+	bound := func(val any, def int) int {
+		if val == nil {
+			return def
+		}
+		if !refx.IsGeneralInt(val) {
+			panic(newError(KindTypeMismatch, "invalid slice index %v", val))
+		}
+		index := refx.AsInt(val)
+		if index < 0 {
+			index += size
+		}
+		if index < 0 {
+			return 0
+		} else if index > size {
+			return size
+		}
+		return index
+	}
+	lo := bound(low, 0)
+	hi := bound(high, size)
+	if hi < lo {
+		hi = lo
+	}
+	if isStr {
+		return string(runes[lo:hi])
+	}
+	if list.Kind() == reflect.Array {
+		ret := make([]any, 0, hi-lo)
+		for i := lo; i < hi; i++ {
+			ret = append(ret, list.Index(i).Interface())
+		}
+		return ret
+	}
+	return list.Slice(lo, hi).Interface()
+}
+
+// evalIn tests x against the elements of a list, the keys of a map or
+// struct, or the substrings of a string
+func evalIn(x any, y any) bool {
+	if refx.IsNil(y) {
+		return false
+	}
+	if refx.IsString(y) {
+		return strings.Contains(refx.AsString(y), refx.AsString(x))
+	}
+	found := false
+	list := refx.IsList(y)
+	refx.ForEach(y, func(key any, val any) {
+		if found {
+			return
+		}
+		if list {
+			found = refx.Cmp(x, val) == refx.CmpEq
+		} else {
+			found = refx.Cmp(x, key) == refx.CmpEq
+		}
+	})
+	return found
+}
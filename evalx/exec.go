@@ -0,0 +1,279 @@
+package evalx
+
+import (
+	"context"
+	"errors"
+	"github.com/avicd/go-utilx/refx"
+	"go/ast"
+	"reflect"
+)
+
+// Binder is a Context that scripts can assign to
+type Binder interface {
+	Context
+	Bind(name string, value any)
+	UnBind(name string)
+}
+
+// scriptKey keeps cached scripts apart from expressions of the same text
+const scriptKey = "#script:"
+
+// Exec runs a script of statements separated by ';' or newlines and returns
+// the value of the last executed one. Assignments to plain names go through
+// the Bind of the Context, members and indices are set on the objects they
+// select.
+func Exec(text string, cts ...Context) (any, error) {
+	var ctx Context
+	if len(cts) > 0 {
+		ctx = cts[0]
+	}
+	return ExecWith(text, ctx, EvalOptions{})
+}
+
+func ExecWith(text string, ctx Context, opts EvalOptions) (any, error) {
+	return ExecContext(context.Background(), text, ctx, opts)
+}
+
+func ExecContext(goCtx context.Context, text string, ctx Context, opts EvalOptions) (any, error) {
+	if ctx == nil {
+		ctx = NewScope()
+	}
+	src := srcOf(text)
+	if src == "" {
+		return nil, &EvalError{Kind: KindSyntax, Err: errors.New("empty script"), Offset: -1}
+	}
+	prog, err := cachedProgram(ctx, text, scriptKey+src, func() (ast.Expr, error) {
+		return ParseScript(src)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prog.RunContext(goCtx, ctx, opts)
+}
+
+func compileBlock(list []ast.Stmt) evalFunc {
+	var stmts []evalFunc
+	for _, stmt := range list {
+		stmts = append(stmts, compileStmt(stmt))
+	}
+	return func(stack *Stack) any {
+		var ret any
+		for _, stmt := range stmts {
+			ret = stmt(stack)
+		}
+		return ret
+	}
+}
+
+func compileStmt(input ast.Stmt) evalFunc {
+	switch stmt := input.(type) {
+	case *ast.ExprStmt:
+		return compileExpr(stmt.X, PROPERTY)
+	case *ast.AssignStmt:
+		return compileAssign(stmt)
+	case *ast.IfStmt:
+		return compileIf(stmt)
+	case *ast.RangeStmt:
+		return compileRange(stmt)
+	case *ast.BlockStmt:
+		return compileBlock(stmt.List)
+	}
+	panic(newError(KindSyntax, "unsupported statement").at(input))
+}
+
+func compileAssign(stmt *ast.AssignStmt) evalFunc {
+	set := compileSetter(stmt.Lhs[0])
+	value := compileExpr(stmt.Rhs[0], PROPERTY)
+	return guard(stmt, func(stack *Stack) any {
+		val := value(stack)
+		set(stack, val)
+		return val
+	})
+}
+
+func compileIf(stmt *ast.IfStmt) evalFunc {
+	cond := compileExpr(stmt.Cond, PROPERTY)
+	body := compileBlock(stmt.Body.List)
+	var other evalFunc
+	if stmt.Else != nil {
+		other = compileStmt(stmt.Else)
+	}
+	return func(stack *Stack) any {
+		if refx.AsBool(cond(stack)) {
+			return body(stack)
+		} else if other != nil {
+			return other(stack)
+		}
+		return nil
+	}
+}
+
+// compileRange binds the loop variables on the Context for each element and
+// restores what was bound to them before once the loop is done, they are
+// unbound if they only came from a parent or a linked object
+func compileRange(stmt *ast.RangeStmt) evalFunc {
+	coll := compileExpr(stmt.X, PROPERTY)
+	body := compileBlock(stmt.Body.List)
+	var names []string
+	if key, ok := stmt.Key.(*ast.Ident); ok {
+		names = append(names, key.Name)
+	}
+	value := stmt.Value.(*ast.Ident).Name
+	names = append(names, value)
+	return guard(stmt, func(stack *Stack) any {
+		binder := binderOf(stack)
+		items := coll(stack)
+		for _, name := range names {
+			if prev, ok := boundOf(binder, name); ok {
+				defer binder.Bind(name, prev)
+			} else {
+				defer binder.UnBind(name)
+			}
+		}
+		var ret any
+		eachOf(items, func(val any, key any) {
+			if len(names) > 1 {
+				binder.Bind(names[0], key)
+			}
+			if stack.limit != nil {
+				stack.limit.step()
+			}
+			binder.Bind(value, val)
+			ret = body(stack)
+		})
+		return ret
+	})
+}
+
+// boundOf is what name is bound to on binder itself, a Binder other than a
+// Scope can't tell it from what it resolves elsewhere
+func boundOf(binder Binder, name string) (any, bool) {
+	if scope, ok := binder.(*Scope); ok {
+		return scope.boundOf(name)
+	}
+	return binder.ValueOf(name)
+}
+
+func binderOf(stack *Stack) Binder {
+	if binder, ok := stack.Ctx.(Binder); ok {
+		return binder
+	}
+	panic(newError(KindRuntime, "can't assign on read-only context %T", stack.Ctx))
+}
+
+// compileSetter compiles the target of an assignment, members and indices
+// are set on the object selected by X
+func compileSetter(input ast.Expr) func(stack *Stack, val any) {
+	switch expr := input.(type) {
+	case *ast.Ident:
+		return func(stack *Stack, val any) {
+			binderOf(stack).Bind(expr.Name, val)
+		}
+	case *ast.SelectorExpr:
+		owner := compileOwner(expr.X)
+		return func(stack *Stack, val any) {
+			setMember(owner(stack), expr.Sel.Name, val)
+		}
+	case *ast.IndexExpr:
+		owner := compileOwner(expr.X)
+		index := compileExpr(expr.Index, PROPERTY)
+		return func(stack *Stack, val any) {
+			setMember(owner(stack), index(stack), val)
+		}
+	}
+	panic(newError(KindSyntax, "cannot assign to expression").at(input))
+}
+
+// compileOwner evaluates the object a member is assigned on, a missing
+// object of a dotted path is created as a map[string]any
+func compileOwner(input ast.Expr) evalFunc {
+	get := compileExpr(input, PROPERTY)
+	switch input.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr:
+	default:
+		return get
+	}
+	set := compileSetter(input)
+	return func(stack *Stack) any {
+		obj := get(stack)
+		if obj == nil {
+			obj = map[string]any{}
+			set(stack, obj)
+		}
+		return obj
+	}
+}
+
+// setMember sets the map entry, struct field or list element key of obj,
+// unlike refx.Set it reports what can't be assigned instead of exiting
+func setMember(obj any, key any, val any) {
+	el := reflect.ValueOf(obj)
+	for el.Kind() == reflect.Pointer || el.Kind() == reflect.Interface {
+		if el.IsNil() {
+			break
+		}
+		el = el.Elem()
+	}
+	switch el.Kind() {
+	case reflect.Map:
+		if el.IsNil() {
+			break
+		}
+		index := assignableOf(key, el.Type().Key())
+		el.SetMapIndex(index, assignableOf(val, el.Type().Elem()))
+		return
+	case reflect.Struct:
+		name, ok := key.(string)
+		if !ok {
+			break
+		}
+		field, ok := el.Type().FieldByName(name)
+		if !ok || !field.IsExported() {
+			panic(newError(KindUndefined, "undefined field %s of %s", name, el.Type()))
+		}
+		if !el.CanSet() {
+			panic(newError(KindRuntime, "can't assign field %s of unaddressable %s", name, el.Type()))
+		}
+		el.FieldByIndex(field.Index).Set(assignableOf(val, field.Type))
+		return
+	case reflect.Slice, reflect.Array:
+		if !refx.IsGeneralInt(key) {
+			break
+		}
+		index := refx.AsInt(key)
+		if index < 0 || index >= el.Len() {
+			panic(newError(KindRuntime, "index %d out of range [0:%d]", index, el.Len()))
+		}
+		item := el.Index(index)
+		if !item.CanSet() {
+			panic(newError(KindRuntime, "can't assign element of unaddressable %s", el.Type()))
+		}
+		item.Set(assignableOf(val, item.Type()))
+		return
+	}
+	panic(newError(KindTypeMismatch, "can't assign member %v of %s", key, refx.TypeOf(obj)))
+}
+
+// assignableOf converts val to typ, numbers convert between their kinds
+func assignableOf(val any, typ reflect.Type) reflect.Value {
+	if val == nil {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(typ)
+		}
+	} else {
+		value := reflect.ValueOf(val)
+		if value.Type().AssignableTo(typ) {
+			return value
+		}
+		if isNumberKind(value.Kind()) && isNumberKind(typ.Kind()) {
+			return value.Convert(typ)
+		}
+	}
+	panic(newError(KindTypeMismatch, "can't assign %s to %s", refx.TypeOf(val), typ))
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Uint64 ||
+		kind == reflect.Float32 || kind == reflect.Float64
+}
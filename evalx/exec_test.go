@@ -0,0 +1,89 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testTarget struct {
+	Count int
+	Any   any
+	Tags  []string
+}
+
+func TestExec(t *testing.T) {
+	cases := map[string]any{
+		"x = 1; y = x + 2; y":  int64(3),
+		"a.b.c = 5\na.b.c * 2": int64(10),
+		"total = 0\nfor v in [1, 2, 3] {\n\ttotal = total + v\n}\ntotal": int64(6),
+		"n = 5; if n > 3 { 'big' } else { 'small' }":                     "big",
+		"n = 1; if n > 3 { 'big' } else if n > 0 { 'one' }":              "one",
+		"if false { 1 }": nil,
+		"s = ''; for k, v in {'a': 1, 'b': 2} { s = s + k + v }; s": "a1b2",
+		"m = {}; m['k'] = 2; m.k":                                   int64(2),
+		"l = [1, 2]; l[1] = 'x'; l":                                 []any{int64(1), "x"},
+		"f = x -> x * 2\nf(4)":                                      int64(8),
+		"sum(map(\n\t[1, 2],\n\tx -> x * 2,\n))":                    int64(6),
+	}
+	for text, expect := range cases {
+		ret, err := Exec(text, NewScope())
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+}
+
+func TestExec_Bind(t *testing.T) {
+	target := &testTarget{Tags: []string{"a"}}
+	scope := NewScope()
+	scope.Bind("t", target)
+	scope.Bind("v", "outer")
+	_, err := scope.Exec("t.Count = 3; t.Any = 'x'; t.Tags[0] = 'b'; for v in [1] { v }")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, &testTarget{Count: 3, Any: "x", Tags: []string{"b"}}, target)
+	ret, _ := scope.Eval("v")
+	assert.Equal(t, "outer", ret)
+
+	_, err = scope.Exec("for i in [1] { i }")
+	assert.Equal(t, nil, err)
+	_, ok := scope.ValueOf("i")
+	assert.False(t, ok)
+
+	// loop variables only resolved through a link or a parent are unbound
+	// afterwards, the originals keep their values
+	item := map[string]any{"n": 1}
+	linked := NewScope(item)
+	_, err = linked.Exec("for n in [5, 6] { n }")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, item["n"])
+	item["n"] = 2
+	ret, _ = linked.Eval("n")
+	assert.Equal(t, 2, ret)
+
+	child := scope.Child()
+	_, err = child.Exec("for v in [1, 2] { v }")
+	assert.Equal(t, nil, err)
+	scope.Bind("v", "changed")
+	ret, _ = child.Eval("v")
+	assert.Equal(t, "changed", ret)
+}
+
+func TestExec_Error(t *testing.T) {
+	scope := NewScope()
+	scope.Bind("t", &testTarget{})
+	cases := map[string]ErrorKind{
+		"t.Missing = 1":   KindUndefined,
+		"t.Count = 'a'":   KindTypeMismatch,
+		"t.Tags[0] = 'a'": KindRuntime,
+		"1 = 2":           KindSyntax,
+		"if true {":       KindSyntax,
+	}
+	for text, kind := range cases {
+		_, err := scope.Exec(text)
+		ee, ok := err.(*EvalError)
+		if assert.True(t, ok, text) {
+			assert.Equal(t, kind, ee.Kind, text)
+		}
+	}
+	_, err := Eval("x = 1")
+	assert.NotEqual(t, nil, err)
+}
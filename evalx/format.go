@@ -0,0 +1,211 @@
+package evalx
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// the precedence of the operands that bind tighter than any binary operator
+const (
+	unaryPrec   = 7
+	primaryPrec = 8
+)
+
+// Format prints expr back as an expression, or a script for a ScriptExpr.
+// Strings are written in single quotes and parentheses only where the
+// operators need them.
+func Format(expr ast.Expr) string {
+	str := &strings.Builder{}
+	writeExpr(str, expr, lowestPrec)
+	return str.String()
+}
+
+func precOf(input ast.Expr) int {
+	switch expr := input.(type) {
+	case *ast.ParenExpr:
+		return precOf(expr.X)
+	case *CondExpr, *LambdaExpr:
+		return lowestPrec
+	case *ast.BinaryExpr:
+		return precedenceOf(expr.Op)
+	case *ast.UnaryExpr:
+		return unaryPrec
+	}
+	return primaryPrec
+}
+
+func writeExpr(str *strings.Builder, input ast.Expr, prec int) {
+	if precOf(input) < prec {
+		str.WriteString("(")
+		writeExpr(str, input, lowestPrec)
+		str.WriteString(")")
+		return
+	}
+	switch expr := input.(type) {
+	case *ast.ParenExpr:
+		writeExpr(str, expr.X, prec)
+	case *ast.Ident:
+		str.WriteString(expr.Name)
+	case *ast.BasicLit:
+		writeLit(str, expr)
+	case *DurationLit:
+		str.WriteString(expr.Value)
+	case *ast.BinaryExpr:
+		prec = precedenceOf(expr.Op)
+		writeExpr(str, expr.X, prec)
+		str.WriteString(" " + tokenString(expr.Op) + " ")
+		writeExpr(str, expr.Y, prec+1)
+	case *ast.UnaryExpr:
+		str.WriteString(expr.Op.String())
+		// -(-x) would otherwise read as a decrement
+		if _, ok := unparen(expr.X).(*ast.UnaryExpr); ok {
+			writeExpr(str, expr.X, primaryPrec)
+		} else {
+			writeExpr(str, expr.X, unaryPrec)
+		}
+	case *CondExpr:
+		writeExpr(str, expr.Cond, lowestPrec+1)
+		str.WriteString(" ? ")
+		writeExpr(str, expr.X, lowestPrec)
+		str.WriteString(" : ")
+		writeExpr(str, expr.Y, lowestPrec)
+	case *ast.SelectorExpr:
+		writeExpr(str, expr.X, primaryPrec)
+		str.WriteString("." + expr.Sel.Name)
+	case *SafeSelectorExpr:
+		writeExpr(str, expr.X, primaryPrec)
+		str.WriteString("?." + expr.Sel.Name)
+	case *ast.IndexExpr:
+		writeExpr(str, expr.X, primaryPrec)
+		str.WriteString("[")
+		writeExpr(str, expr.Index, lowestPrec)
+		str.WriteString("]")
+	case *ast.SliceExpr:
+		writeExpr(str, expr.X, primaryPrec)
+		str.WriteString("[")
+		if expr.Low != nil {
+			writeExpr(str, expr.Low, lowestPrec)
+		}
+		str.WriteString(":")
+		if expr.High != nil {
+			writeExpr(str, expr.High, lowestPrec)
+		}
+		str.WriteString("]")
+	case *ast.CallExpr:
+		writeExpr(str, expr.Fun, primaryPrec)
+		str.WriteString("(")
+		writeList(str, expr.Args)
+		if expr.Ellipsis.IsValid() {
+			str.WriteString("...")
+		}
+		str.WriteString(")")
+	case *ast.CompositeLit:
+		if _, ok := expr.Type.(*ast.MapType); ok {
+			str.WriteString("{")
+			writeList(str, expr.Elts)
+			str.WriteString("}")
+		} else {
+			str.WriteString("[")
+			writeList(str, expr.Elts)
+			str.WriteString("]")
+		}
+	case *ast.KeyValueExpr:
+		writeExpr(str, expr.Key, lowestPrec)
+		str.WriteString(": ")
+		writeExpr(str, expr.Value, lowestPrec)
+	case *LambdaExpr:
+		if len(expr.Params) == 1 {
+			str.WriteString(expr.Params[0].Name)
+		} else {
+			str.WriteString("(")
+			for i, param := range expr.Params {
+				if i > 0 {
+					str.WriteString(", ")
+				}
+				str.WriteString(param.Name)
+			}
+			str.WriteString(")")
+		}
+		str.WriteString(" -> ")
+		writeExpr(str, expr.Body, lowestPrec)
+	case *ScriptExpr:
+		writeStmts(str, expr.Body.List)
+	}
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+// writeLit prints a string in single quotes unless it holds one, its
+// content is kept as written since the parser doesn't unescape it
+func writeLit(str *strings.Builder, expr *ast.BasicLit) {
+	value := expr.Value
+	if len(value) >= 2 && value[0] == '"' && !strings.Contains(value, "'") {
+		value = "'" + value[1:len(value)-1] + "'"
+	}
+	str.WriteString(value)
+}
+
+func writeList(str *strings.Builder, list []ast.Expr) {
+	for i, item := range list {
+		if i > 0 {
+			str.WriteString(", ")
+		}
+		writeExpr(str, item, lowestPrec)
+	}
+}
+
+func writeStmts(str *strings.Builder, list []ast.Stmt) {
+	for i, stmt := range list {
+		if i > 0 {
+			str.WriteString("; ")
+		}
+		writeStmt(str, stmt)
+	}
+}
+
+func writeStmt(str *strings.Builder, input ast.Stmt) {
+	switch stmt := input.(type) {
+	case *ast.ExprStmt:
+		writeExpr(str, stmt.X, lowestPrec)
+	case *ast.AssignStmt:
+		writeList(str, stmt.Lhs)
+		str.WriteString(" " + stmt.Tok.String() + " ")
+		writeList(str, stmt.Rhs)
+	case *ast.BlockStmt:
+		if len(stmt.List) == 0 {
+			str.WriteString("{}")
+			return
+		}
+		str.WriteString("{ ")
+		writeStmts(str, stmt.List)
+		str.WriteString(" }")
+	case *ast.IfStmt:
+		str.WriteString("if ")
+		writeExpr(str, stmt.Cond, lowestPrec)
+		str.WriteString(" ")
+		writeStmt(str, stmt.Body)
+		if stmt.Else != nil {
+			str.WriteString(" else ")
+			writeStmt(str, stmt.Else)
+		}
+	case *ast.RangeStmt:
+		str.WriteString("for ")
+		if stmt.Key != nil {
+			writeExpr(str, stmt.Key, lowestPrec)
+			str.WriteString(", ")
+		}
+		writeExpr(str, stmt.Value, lowestPrec)
+		str.WriteString(" in ")
+		writeExpr(str, stmt.X, lowestPrec)
+		str.WriteString(" ")
+		writeStmt(str, stmt.Body)
+	}
+}
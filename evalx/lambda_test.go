@@ -0,0 +1,46 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLambda(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"orders": []map[string]any{
+			{"id": 1, "total": 120},
+			{"id": 2, "total": 80},
+			{"id": 3, "total": 300},
+		},
+		"users": []*testEval{{A: 30, B: "Bob"}, {A: 20, B: "Amy"}},
+		"stock": map[string]int{"apple": 3, "pear": 0},
+		"o":     "outer",
+		"limit": 100,
+	})
+	cases := map[string]any{
+		"map(filter(orders, o -> o.total > limit), o -> o.id)": []any{1, 3},
+		"map(users, u -> u.B)":                                 []any{"Bob", "Amy"},
+		"map(sortBy(users, u -> u.A), u -> u.B)":               []any{"Amy", "Bob"},
+		"any(orders, o -> o.total < 100)":                      true,
+		"all(orders, o -> o.total < 100)":                      false,
+		"all([], x -> false)":                                  true,
+		"filter(stock, (n, name) -> n > 0)":                    map[string]int{"apple": 3},
+		"map(stock, (n, name) -> name + ':' + n)":              []any{"apple:3", "pear:0"},
+		"map([1, 2], (x) -> x * 10)":                           []any{int64(10), int64(20)},
+		"map([[1, 2], [3]], l -> map(l, x -> x + len(l)))": []any{
+			[]any{int64(3), int64(4)}, []any{int64(4)},
+		},
+		"len(filter(orders, o -> o.total > 100)) + len(o)": int64(7),
+		"sortBy([3, 1, 2], x -> -x)":                       []any{int64(3), int64(2), int64(1)},
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+
+	_, err := ParseExpr("map(items, (a.b) -> a)")
+	assert.NotEqual(t, nil, err)
+	_, err = ParseExpr("(a, b)")
+	assert.NotEqual(t, nil, err)
+}
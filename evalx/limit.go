@@ -0,0 +1,94 @@
+package evalx
+
+import (
+	"context"
+	"errors"
+	"github.com/avicd/go-utilx/refx"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrStepLimit  = errors.New("step limit exceeded")
+	ErrDepthLimit = errors.New("call depth limit exceeded")
+	ErrSizeLimit  = errors.New("size limit exceeded")
+)
+
+// Limits bound a single evaluation, a zero field means unlimited. They are
+// checked between the nodes of the expression, a bound function that blocks
+// is not interrupted.
+type Limits struct {
+	// MaxSteps is the number of nodes evaluated
+	MaxSteps int
+	// MaxDepth is the number of nested function calls
+	MaxDepth int
+	// MaxSize is the length of a string, list or map produced by a call or a
+	// concatenation
+	MaxSize int
+	// Timeout is added as a deadline to the context.Context of the evaluation
+	Timeout time.Duration
+}
+
+// limiter holds the counters of an evaluation, it is shared by every Stack
+// forked from the one it was created for and by the lambdas it hands to
+// bound functions, which may call them from other goroutines
+type limiter struct {
+	Limits
+	ctx   context.Context
+	done  <-chan struct{}
+	steps atomic.Int64
+	depth atomic.Int64
+}
+
+func newLimiter(ctx context.Context, limits Limits) *limiter {
+	done := ctx.Done()
+	if done == nil && limits == (Limits{}) {
+		return nil
+	}
+	return &limiter{Limits: limits, ctx: ctx, done: done}
+}
+
+func (it *limiter) step() {
+	steps := it.steps.Add(1)
+	if it.MaxSteps > 0 && steps > int64(it.MaxSteps) {
+		panic(newError(KindLimit, "%w: %d", ErrStepLimit, it.MaxSteps))
+	}
+	if it.done != nil {
+		select {
+		case <-it.done:
+			panic(newError(KindLimit, "%w", it.ctx.Err()))
+		default:
+		}
+	}
+}
+
+func (it *limiter) enter() {
+	depth := it.depth.Add(1)
+	if it.MaxDepth > 0 && depth > int64(it.MaxDepth) {
+		panic(newError(KindLimit, "%w: %d", ErrDepthLimit, it.MaxDepth))
+	}
+}
+
+func (it *limiter) leave() {
+	it.depth.Add(-1)
+}
+
+func (it *limiter) size(val any) {
+	if it.MaxSize < 1 || val == nil {
+		return
+	}
+	size := 0
+	if str, ok := val.(string); ok {
+		size = len(str)
+	} else {
+		el := refx.Indirect(val)
+		switch el.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			size = el.Len()
+		}
+	}
+	if size > it.MaxSize {
+		panic(newError(KindLimit, "%w: %d", ErrSizeLimit, it.MaxSize))
+	}
+}
@@ -0,0 +1,109 @@
+package evalx
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvalContext_Limits(t *testing.T) {
+	scope := NewScope()
+	scope.Bind("repeat", func(text string, n int64) string {
+		return strings.Repeat(text, int(n))
+	})
+	scope.Bind("spin", func(n int64) int64 {
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		return n
+	})
+	cases := []struct {
+		text   string
+		limits Limits
+		err    error
+	}{
+		{"len('a') + 2 + 3", Limits{MaxSteps: 3}, ErrStepLimit},
+		{"map([1], x -> len('a'))", Limits{MaxDepth: 1}, ErrDepthLimit},
+		{"repeat('a', 10)", Limits{MaxSize: 5}, ErrSizeLimit},
+		{"repeat('a', 2) + repeat('b', 4)", Limits{MaxSize: 5}, ErrSizeLimit},
+		{"spin(20) + spin(1)", Limits{Timeout: time.Millisecond}, context.DeadlineExceeded},
+	}
+	for _, item := range cases {
+		_, err := EvalContext(context.Background(), item.text, scope, EvalOptions{Limits: item.limits})
+		assert.True(t, errors.Is(err, item.err), item.text)
+		var ee *EvalError
+		if assert.True(t, errors.As(err, &ee), item.text) {
+			assert.Equal(t, KindLimit, ee.Kind, item.text)
+		}
+	}
+
+	limits := Limits{MaxSteps: 6, MaxDepth: 2, MaxSize: 5}
+	ret, err := EvalContext(context.Background(), "len(repeat('a', 5))", scope, EvalOptions{Limits: limits})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, ret)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = EvalContext(ctx, "1", scope, EvalOptions{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestExecContext_Limits(t *testing.T) {
+	script := "f = n -> n < 1 ? 0 : f(n - 1)\nf(10)"
+	_, err := ExecContext(context.Background(), script, NewScope(), EvalOptions{Limits: Limits{MaxDepth: 5}})
+	assert.True(t, errors.Is(err, ErrDepthLimit))
+	ret, err := ExecContext(context.Background(), script, NewScope(), EvalOptions{Limits: Limits{MaxDepth: 20}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(0), ret)
+
+	script = "s = 'ab'\nfor i in [1, 2, 3, 4] { s = s + s }"
+	_, err = ExecContext(context.Background(), script, NewScope(), EvalOptions{Limits: Limits{MaxSize: 16}})
+	assert.True(t, errors.Is(err, ErrSizeLimit))
+}
+
+func TestLambda_Limits(t *testing.T) {
+	opts := EvalOptions{Limits: Limits{MaxSteps: 50, Timeout: time.Second}}
+	scope := NewScope()
+	_, err := ExecContext(context.Background(), "double = x -> x * 2", scope, opts)
+	assert.Equal(t, nil, err)
+	fn, err := scope.EvalWith("x -> x + 1", opts)
+	assert.Equal(t, nil, err)
+	scope.Bind("inc", fn)
+	for i := 0; i < 10; i++ {
+		ret, err := scope.EvalWith("inc(double(20))", opts)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, int64(41), ret)
+	}
+
+	_, err = scope.EvalWith("map([1, 2, 3, 4, 5, 6, 7, 8, 9, 10], double)", EvalOptions{Limits: Limits{MaxSteps: 20}})
+	assert.True(t, errors.Is(err, ErrStepLimit))
+}
+
+func TestLambda_ConcurrentLimits(t *testing.T) {
+	scope := NewScope()
+	scope.Bind("parallel", func(fn func(args ...any) any) int64 {
+		var wg sync.WaitGroup
+		rets := make([]int64, 8)
+		for i := range rets {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					rets[i] += fn(j).(int64)
+				}
+			}(i)
+		}
+		wg.Wait()
+		total := int64(0)
+		for _, ret := range rets {
+			total += ret
+		}
+		return total
+	})
+	opts := EvalOptions{Limits: Limits{MaxSteps: 100000, MaxDepth: 10}}
+	ret, err := scope.EvalWith("parallel(x -> x + 1)", opts)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(8*5050), ret)
+}
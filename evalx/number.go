@@ -0,0 +1,317 @@
+package evalx
+
+import (
+	"github.com/avicd/go-utilx/refx"
+	"go/ast"
+	"go/token"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+type NumberMode uint
+
+const (
+	// NumberNative computes with int64 and float64
+	NumberNative NumberMode = iota
+	// NumberBig computes with *big.Int and *big.Float
+	NumberBig
+	// NumberDecimal computes with *big.Int and *big.Rat, so decimal fractions
+	// are exact and dividing integers gives a *big.Rat
+	NumberDecimal
+)
+
+const DefaultPrecision = 256
+
+// ratDigits is the number of decimal places printed for a fraction that
+// has no exact decimal form
+const ratDigits = 20
+
+func isBig(val any) bool {
+	switch val.(type) {
+	case *big.Int, *big.Float, *big.Rat:
+		return true
+	}
+	return false
+}
+
+func isNumeric(val any) bool {
+	return refx.IsNumber(val) || isBig(val)
+}
+
+func (it *EvalOptions) newFloat() *big.Float {
+	prec := it.Precision
+	if prec == 0 {
+		prec = DefaultPrecision
+	}
+	return new(big.Float).SetPrec(prec).SetMode(it.Rounding)
+}
+
+// compileNumber parses a numeric literal once for every mode, the big values
+// handed out are copies so a bound function can't alter the literal
+func compileNumber(expr *ast.BasicLit) evalFunc {
+	val := evalBasicLit(expr)
+	var integer *big.Int
+	var rat *big.Rat
+	if expr.Kind == token.INT {
+		integer, _ = new(big.Int).SetString(expr.Value, 0)
+	} else {
+		rat, _ = new(big.Rat).SetString(expr.Value)
+	}
+	if integer == nil && rat == nil {
+		return func(stack *Stack) any {
+			return val
+		}
+	}
+	return func(stack *Stack) any {
+		switch stack.Options.Numbers {
+		case NumberBig:
+			if integer != nil {
+				return new(big.Int).Set(integer)
+			}
+			return stack.Options.newFloat().SetRat(rat)
+		case NumberDecimal:
+			if integer != nil {
+				return new(big.Int).Set(integer)
+			}
+			return new(big.Rat).Set(rat)
+		}
+		return val
+	}
+}
+
+func arithmeticOf(stack *Stack, op token.Token, x, y any, lits operands) any {
+	opts := &stack.Options
+	if isTime(x) || isTime(y) {
+		return evalTime(op, x, y)
+	} else if opts.Numbers != NumberNative {
+		return evalBig(op, x, y, opts)
+	} else if isTyped(opts, x, y) {
+		return evalTyped(op, x, y, lits, opts)
+	}
+	return evalArithmetic(op, x, y)
+}
+
+// evalBig applies op on big numbers, integers stay integers but for their
+// quotient in NumberDecimal, and anything else is computed in the mode of
+// opts, or the mode of its big operand when opts is native
+func evalBig(op token.Token, x, y any, opts *EvalOptions) any {
+	if !isNumeric(x) || !isNumeric(y) {
+		return nil
+	}
+	if op == token.QUO && opts.Numbers == NumberDecimal {
+		return ratArithmetic(op, ratOf(x), ratOf(y), opts)
+	}
+	if a, ok := bigIntOf(x); ok {
+		if b, ok := bigIntOf(y); ok {
+			return bigIntArithmetic(op, a, b)
+		}
+	}
+	mode := opts.Numbers
+	if mode == NumberNative {
+		mode = NumberBig
+		if _, ok := x.(*big.Rat); ok {
+			mode = NumberDecimal
+		} else if _, ok = y.(*big.Rat); ok {
+			mode = NumberDecimal
+		}
+	}
+	if mode == NumberDecimal {
+		return ratArithmetic(op, ratOf(x), ratOf(y), opts)
+	}
+	return bigFloatArithmetic(op, bigFloatOf(x, opts), bigFloatOf(y, opts), opts)
+}
+
+func bigIntOf(val any) (*big.Int, bool) {
+	if tmp, ok := val.(*big.Int); ok {
+		return tmp, true
+	} else if refx.IsUInteger(val) {
+		return new(big.Int).SetUint64(refx.AsUint64(val)), true
+	} else if refx.IsInteger(val) {
+		return big.NewInt(refx.AsInt64(val)), true
+	}
+	return nil, false
+}
+
+// ratOf takes a float64 by its shortest decimal form, so 0.1 is 1/10
+// rather than the binary fraction closest to it
+func ratOf(val any) *big.Rat {
+	switch tmp := val.(type) {
+	case *big.Rat:
+		return tmp
+	case *big.Float:
+		if ret, _ := tmp.Rat(nil); ret != nil {
+			return ret
+		}
+		panic(newError(KindTypeMismatch, "can't use %v as a decimal", tmp))
+	}
+	if num, ok := bigIntOf(val); ok {
+		return new(big.Rat).SetInt(num)
+	}
+	num := refx.AsFloat64(val)
+	if ret, ok := new(big.Rat).SetString(strconv.FormatFloat(num, 'g', -1, 64)); ok {
+		return ret
+	}
+	panic(newError(KindTypeMismatch, "can't use %v as a decimal", num))
+}
+
+func bigFloatOf(val any, opts *EvalOptions) *big.Float {
+	switch tmp := val.(type) {
+	case *big.Float:
+		return tmp
+	case *big.Rat:
+		return opts.newFloat().SetRat(tmp)
+	}
+	if num, ok := bigIntOf(val); ok {
+		return opts.newFloat().SetInt(num)
+	}
+	num := refx.AsFloat64(val)
+	if math.IsNaN(num) {
+		panic(newError(KindTypeMismatch, "can't use NaN as a big number"))
+	}
+	return opts.newFloat().SetFloat64(num)
+}
+
+func bigIntArithmetic(op token.Token, a, b *big.Int) any {
+	ret := new(big.Int)
+	switch op {
+	case token.ADD:
+		return ret.Add(a, b)
+	case token.SUB:
+		return ret.Sub(a, b)
+	case token.MUL:
+		return ret.Mul(a, b)
+	case token.QUO, token.REM:
+		if b.Sign() == 0 {
+			panic(newError(KindDivisionByZero, "integer division by zero"))
+		}
+		if op == token.QUO {
+			return ret.Quo(a, b)
+		}
+		return ret.Rem(a, b)
+	}
+	return nil
+}
+
+func ratArithmetic(op token.Token, a, b *big.Rat, opts *EvalOptions) any {
+	ret := new(big.Rat)
+	switch op {
+	case token.ADD:
+		return ret.Add(a, b)
+	case token.SUB:
+		return ret.Sub(a, b)
+	case token.MUL:
+		return ret.Mul(a, b)
+	case token.QUO:
+		if b.Sign() == 0 {
+			panic(newError(KindDivisionByZero, "decimal division by zero"))
+		}
+		ret.Quo(a, b)
+		if opts.Scale > 0 {
+			return roundRat(ret, opts.Scale, opts.Rounding)
+		}
+		return ret
+	case token.REM:
+		panic(newError(KindTypeMismatch, "invalid operator '%s' on decimal", op))
+	}
+	return nil
+}
+
+func bigFloatArithmetic(op token.Token, a, b *big.Float, opts *EvalOptions) any {
+	ret := opts.newFloat()
+	switch op {
+	case token.ADD:
+		return ret.Add(a, b)
+	case token.SUB:
+		return ret.Sub(a, b)
+	case token.MUL:
+		return ret.Mul(a, b)
+	case token.QUO:
+		if b.Sign() == 0 {
+			panic(newError(KindDivisionByZero, "float division by zero"))
+		}
+		return ret.Quo(a, b)
+	case token.REM:
+		panic(newError(KindTypeMismatch, "invalid operator '%s' on float", op))
+	}
+	return nil
+}
+
+// roundRat rounds num to scale decimal places the way mode rounds the
+// mantissa of a big.Float
+func roundRat(num *big.Rat, scale int, mode big.RoundingMode) *big.Rat {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	scaled := new(big.Int).Mul(num.Num(), unit)
+	quo, rem := new(big.Int).QuoRem(scaled, num.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		away := false
+		half := new(big.Int).Abs(rem)
+		half.Lsh(half, 1)
+		switch mode {
+		case big.ToNearestEven:
+			cmp := half.Cmp(num.Denom())
+			away = cmp > 0 || cmp == 0 && quo.Bit(0) == 1
+		case big.ToNearestAway:
+			away = half.Cmp(num.Denom()) >= 0
+		case big.AwayFromZero:
+			away = true
+		case big.ToNegativeInf:
+			away = num.Sign() < 0
+		case big.ToPositiveInf:
+			away = num.Sign() > 0
+		}
+		if away {
+			quo.Add(quo, big.NewInt(int64(num.Sign())))
+		}
+	}
+	return new(big.Rat).SetFrac(quo, unit)
+}
+
+func negBig(val any) any {
+	switch tmp := val.(type) {
+	case *big.Int:
+		return new(big.Int).Neg(tmp)
+	case *big.Rat:
+		return new(big.Rat).Neg(tmp)
+	case *big.Float:
+		return new(big.Float).SetPrec(tmp.Prec()).SetMode(tmp.Mode()).Neg(tmp)
+	}
+	return nil
+}
+
+// decimalString prints a fraction with as many decimal places as it takes
+// to be exact, or ratDigits when it has no exact decimal form
+func decimalString(num *big.Rat) string {
+	if num.IsInt() {
+		return num.Num().String()
+	}
+	den := new(big.Int).Set(num.Denom())
+	digits := 0
+	for _, prime := range []int64{2, 5} {
+		count := 0
+		factor := big.NewInt(prime)
+		mod := new(big.Int)
+		for {
+			quo, rem := new(big.Int).QuoRem(den, factor, mod)
+			if rem.Sign() != 0 {
+				break
+			}
+			den = quo
+			count++
+		}
+		if count > digits {
+			digits = count
+		}
+	}
+	if den.Cmp(big.NewInt(1)) != 0 {
+		digits = ratDigits
+	}
+	return num.FloatString(digits)
+}
+
+func stringOf(val any) string {
+	if num, ok := val.(*big.Rat); ok {
+		return decimalString(num)
+	}
+	return refx.AsString(val)
+}
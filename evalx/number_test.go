@@ -0,0 +1,101 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestEvalWith_Decimal(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"price": 0.1,
+		"qty":   3,
+		"large": int64(1) << 62,
+	})
+	opts := EvalOptions{Numbers: NumberDecimal}
+	cases := map[string]string{
+		"0.1 + 0.2":          "0.3",
+		"price * qty":        "0.3",
+		"1.0 / 3":            "0.33333333333333333333",
+		"large * 4":          "18446744073709551616",
+		"7 / 2":              "3.5",
+		"1 / 3":              "0.33333333333333333333",
+		"-6 / qty":           "-2",
+		"7 % 2":              "1",
+		"-(price - 1)":       "0.9",
+		"string(0.5 + 0.25)": "0.75",
+		"'$' + 1.10 * 2":     "$2.2",
+		"sum([0.1, 0.2])":    "0.3",
+	}
+	for text, expect := range cases {
+		ret, err := scope.EvalWith(text, opts)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, stringOf(ret), text)
+	}
+	bools := map[string]bool{
+		"0.1 + 0.2 == 0.3":   true,
+		"price * qty == 0.3": true,
+		"large * 4 > large":  true,
+		"0.3 in [0.1 + 0.2]": true,
+		"max(1, 2.5) == 2.5": true,
+	}
+	for text, expect := range bools {
+		ret, err := scope.EvalWith(text, opts)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+
+	ret, _ := scope.EvalWith("0.1 + 0.2", opts)
+	assert.Equal(t, big.NewRat(3, 10), ret)
+	ret, _ = scope.EvalWith("1 / 3", opts)
+	assert.Equal(t, big.NewRat(1, 3), ret)
+	ret, _ = scope.EvalWith("1 / 3", EvalOptions{})
+	assert.Equal(t, int64(0), ret)
+	ret, _ = scope.EvalWith("float(int(10.0 / 4) + 1.5)", opts)
+	assert.Equal(t, 3.5, ret)
+	_, err := scope.EvalWith("1.5 / 0", opts)
+	assert.Equal(t, KindDivisionByZero, err.(*EvalError).Kind)
+	_, err = scope.EvalWith("1 / 0", opts)
+	assert.Equal(t, KindDivisionByZero, err.(*EvalError).Kind)
+}
+
+func TestEvalWith_Rounding(t *testing.T) {
+	cases := []struct {
+		text     string
+		rounding big.RoundingMode
+		expect   string
+	}{
+		{"2.5 / 100", big.ToNearestEven, "0.02"},
+		{"3.5 / 100", big.ToNearestEven, "0.04"},
+		{"2.5 / 100", big.ToNearestAway, "0.03"},
+		{"2.01 / 100", big.ToZero, "0.02"},
+		{"2.01 / 100", big.AwayFromZero, "0.03"},
+		{"-2.01 / 100", big.ToNegativeInf, "-0.03"},
+		{"-2.01 / 100", big.ToPositiveInf, "-0.02"},
+		{"1.0 / 3", big.ToNearestEven, "0.33"},
+	}
+	for _, item := range cases {
+		opts := EvalOptions{Numbers: NumberDecimal, Scale: 2, Rounding: item.rounding}
+		ret, err := EvalWith(item.text, nil, opts)
+		assert.Equal(t, nil, err, item.text)
+		assert.Equal(t, item.expect, stringOf(ret), "%s %v", item.text, item.rounding)
+	}
+}
+
+func TestEvalWith_Big(t *testing.T) {
+	opts := EvalOptions{Numbers: NumberBig, Precision: 64}
+	ret, err := EvalWith("9223372036854775807 + 1", nil, opts)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "9223372036854775808", stringOf(ret))
+
+	ret, err = EvalWith("1.0 / 3", nil, opts)
+	assert.Equal(t, nil, err)
+	if num, ok := ret.(*big.Float); assert.True(t, ok) {
+		assert.Equal(t, uint(64), num.Prec())
+		assert.Equal(t, "0.3333333333333333333", num.Text('g', 19))
+	}
+
+	ret, err = EvalWith("x * 2", NewScope(map[string]any{"x": big.NewInt(21)}), EvalOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, big.NewInt(42), ret)
+}
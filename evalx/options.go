@@ -0,0 +1,46 @@
+package evalx
+
+import (
+	"context"
+	"math/big"
+)
+
+type EvalOptions struct {
+	// Strict reports unresolved identifiers, struct fields and map keys as
+	// KindUndefined errors instead of evaluating them to nil
+	Strict bool
+	Limits Limits
+	// Typed computes integers the way Go does: results keep the type of the
+	// operands, untyped constants adapt to the other operand and overflow
+	// wraps around
+	Typed bool
+	// Overflow reports an integer result that doesn't fit its type, int64
+	// unless Typed, as a KindOverflow error
+	Overflow bool
+	// Numbers promotes numeric literals and operands to math/big
+	Numbers NumberMode
+	// Precision is the mantissa of a big.Float in bits, DefaultPrecision if 0
+	Precision uint
+	// Scale is the number of decimal places a quotient keeps in
+	// NumberDecimal, 0 keeps it exact
+	Scale int
+	// Rounding applies to Precision and Scale
+	Rounding big.RoundingMode
+}
+
+func EvalWith(text string, ctx Context, opts EvalOptions) (any, error) {
+	return EvalContext(context.Background(), text, ctx, opts)
+}
+
+// EvalContext evaluates text until goCtx is done or one of the Limits of opts
+// is exceeded, both abort with a KindLimit error
+func EvalContext(goCtx context.Context, text string, ctx Context, opts EvalOptions) (any, error) {
+	if ctx == nil {
+		ctx = NewScope()
+	}
+	prog, err := programOf(text, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return prog.RunContext(goCtx, ctx, opts)
+}
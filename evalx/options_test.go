@@ -0,0 +1,54 @@
+package evalx
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvalWith_Strict(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"user": map[string]any{
+			"name":    "Allen",
+			"address": nil,
+		},
+		"items": []int{1, 2},
+		"p":     &testEval{A: 25},
+	})
+	strict := EvalOptions{Strict: true}
+
+	ret, err := scope.Eval("usr.name == nil")
+	assert.Equal(t, true, ret)
+	assert.Equal(t, nil, err)
+
+	cases := map[string]string{
+		"usr.name == nil": "usr",
+		"user.nmae":       "user.nmae",
+		"user['age']":     "user['age']",
+		"items[5]":        "items[5]",
+		"p.C":             "p.C",
+	}
+	for text, node := range cases {
+		_, err := scope.EvalWith(text, strict)
+		var ee *EvalError
+		assert.Equal(t, true, errors.As(err, &ee), text)
+		if ee != nil {
+			assert.Equal(t, KindUndefined, ee.Kind, text)
+			assert.Equal(t, node, ee.Node, text)
+		}
+	}
+
+	valid := map[string]any{
+		"user.name":            "Allen",
+		"user.address?.city":   nil,
+		"user.address ?? 'na'": "na",
+		"items[1]":             2,
+		"p.A":                  25,
+		"upper(user.name)":     "ALLEN",
+	}
+	for text, expect := range valid {
+		ret, err := scope.EvalWith(text, strict)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+}
@@ -0,0 +1,456 @@
+package evalx
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"time"
+)
+
+const (
+	tokQuestion token.Token = iota + 2000
+	tokSafePeriod
+	tokArrow
+)
+
+const lowestPrec = 0
+
+type exprParser struct {
+	src     []byte
+	file    *token.File
+	scanner scanner.Scanner
+	errors  scanner.ErrorList
+	pos     token.Pos
+	tok     token.Token
+	lit     string
+	// newlines separate statements of a script, except within brackets
+	script bool
+	depth  int
+}
+
+func ParseExpr(text string) (ast.Expr, error) {
+	p := newExprParser(text, false)
+	expr := p.parseExpr()
+	if p.tok != token.EOF {
+		p.errorExpected("end of expression")
+	}
+	if err := p.errors.Err(); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func ParseScript(text string) (*ScriptExpr, error) {
+	p := newExprParser(text, true)
+	body := &ast.BlockStmt{Lbrace: p.pos, List: p.parseStmtList()}
+	body.Rbrace = p.pos
+	if p.tok != token.EOF {
+		p.errorExpected("statement")
+	}
+	if err := p.errors.Err(); err != nil {
+		return nil, err
+	}
+	return &ScriptExpr{Body: body}, nil
+}
+
+func newExprParser(text string, script bool) *exprParser {
+	p := &exprParser{src: []byte(text), script: script}
+	p.file = token.NewFileSet().AddFile("", -1, len(p.src))
+	p.scanner.Init(p.file, p.src, func(pos token.Position, msg string) {
+		// '?' is not part of go, it is handled by next
+		if pos.Offset < len(p.src) && p.src[pos.Offset] == '?' {
+			return
+		}
+		p.errors.Add(pos, msg)
+	}, 0)
+	p.next()
+	return p
+}
+
+func (p *exprParser) next() {
+	p.pos, p.tok, p.lit = p.scanner.Scan()
+	for p.tok == token.SEMICOLON && p.lit == "\n" && (!p.script || p.depth > 0) {
+		p.pos, p.tok, p.lit = p.scanner.Scan()
+	}
+	if p.tok == token.IDENT && p.lit == "in" {
+		p.tok = IN
+	} else if p.tok == token.SUB && p.follow(0) == '>' {
+		p.scanner.Scan()
+		p.tok = tokArrow
+		p.lit = "->"
+	} else if p.tok == token.ILLEGAL && p.lit == "?" {
+		switch next := p.follow(1); p.follow(0) {
+		case '?':
+			p.scanner.Scan()
+			p.tok = COALESCE
+			p.lit = "??"
+		case '.':
+			// ?.5 is a condition followed by a float
+			if next >= '0' && next <= '9' {
+				p.tok = tokQuestion
+				break
+			}
+			p.scanner.Scan()
+			p.tok = tokSafePeriod
+			p.lit = "?."
+		default:
+			p.tok = tokQuestion
+		}
+	}
+}
+
+// follow peeks the byte n bytes after the end of the current token
+func (p *exprParser) follow(n int) byte {
+	size := len(p.lit)
+	if size == 0 {
+		size = len(p.tok.String())
+	}
+	offset := p.file.Offset(p.pos) + size + n
+	if offset < len(p.src) {
+		return p.src[offset]
+	}
+	return 0
+}
+
+func (p *exprParser) error(pos token.Pos, msg string) {
+	p.errors.Add(p.file.Position(pos), msg)
+}
+
+func (p *exprParser) errorExpected(msg string) {
+	found := p.lit
+	if found == "" || p.tok.IsOperator() {
+		found = tokenString(p.tok)
+	}
+	p.error(p.pos, "expected "+msg+", found '"+found+"'")
+}
+
+func (p *exprParser) expect(tok token.Token) token.Pos {
+	pos := p.pos
+	if p.tok != tok {
+		p.errorExpected("'" + tokenString(tok) + "'")
+	}
+	p.next()
+	return pos
+}
+
+func (p *exprParser) open(tok token.Token) token.Pos {
+	p.depth++
+	return p.expect(tok)
+}
+
+func (p *exprParser) close(tok token.Token) token.Pos {
+	p.depth--
+	return p.expect(tok)
+}
+
+func (p *exprParser) parseExpr() ast.Expr {
+	return p.parseCondExpr()
+}
+
+func (p *exprParser) parseCondExpr() ast.Expr {
+	cond := p.parseBinaryExpr(lowestPrec + 1)
+	if p.tok != tokQuestion {
+		return cond
+	}
+	question := p.pos
+	p.next()
+	x := p.parseCondExpr()
+	colon := p.expect(token.COLON)
+	y := p.parseCondExpr()
+	return &CondExpr{Cond: cond, Question: question, X: x, Colon: colon, Y: y}
+}
+
+func precedenceOf(tok token.Token) int {
+	switch tok {
+	case COALESCE:
+		return 1
+	case IN:
+		return token.EQL.Precedence() + 1
+	case token.LOR, token.LAND, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+		token.ADD, token.SUB, token.OR, token.XOR,
+		token.MUL, token.QUO, token.REM, token.SHL, token.SHR, token.AND, token.AND_NOT:
+		return tok.Precedence() + 1
+	}
+	return lowestPrec
+}
+
+func (p *exprParser) parseBinaryExpr(prec int) ast.Expr {
+	x := p.parseUnaryExpr()
+	for {
+		oprec := precedenceOf(p.tok)
+		if oprec < prec {
+			return x
+		}
+		pos, op := p.pos, p.tok
+		p.next()
+		y := p.parseBinaryExpr(oprec + 1)
+		x = &ast.BinaryExpr{X: x, OpPos: pos, Op: op, Y: y}
+	}
+}
+
+func (p *exprParser) parseUnaryExpr() ast.Expr {
+	switch p.tok {
+	case token.NOT, token.SUB, token.ADD, token.XOR:
+		pos, op := p.pos, p.tok
+		p.next()
+		x := p.parseUnaryExpr()
+		return &ast.UnaryExpr{OpPos: pos, Op: op, X: x}
+	}
+	return p.parsePrimaryExpr()
+}
+
+func (p *exprParser) parsePrimaryExpr() ast.Expr {
+	x := p.parseOperand()
+	for {
+		switch p.tok {
+		case token.PERIOD:
+			p.next()
+			x = &ast.SelectorExpr{X: x, Sel: p.parseIdent()}
+		case tokSafePeriod:
+			p.next()
+			x = &SafeSelectorExpr{X: x, Sel: p.parseIdent()}
+		case token.LBRACK:
+			x = p.parseIndexOrSlice(x)
+		case token.LPAREN:
+			x = p.parseCall(x)
+		default:
+			return x
+		}
+	}
+}
+
+func (p *exprParser) parseIndexOrSlice(x ast.Expr) ast.Expr {
+	lbrack := p.open(token.LBRACK)
+	var index [2]ast.Expr
+	if p.tok != token.COLON {
+		index[0] = p.parseExpr()
+	}
+	if p.tok != token.COLON {
+		rbrack := p.close(token.RBRACK)
+		return &ast.IndexExpr{X: x, Lbrack: lbrack, Index: index[0], Rbrack: rbrack}
+	}
+	p.next()
+	if p.tok != token.RBRACK {
+		index[1] = p.parseExpr()
+	}
+	rbrack := p.close(token.RBRACK)
+	return &ast.SliceExpr{X: x, Lbrack: lbrack, Low: index[0], High: index[1], Rbrack: rbrack}
+}
+
+func (p *exprParser) parseCall(fun ast.Expr) *ast.CallExpr {
+	lparen := p.open(token.LPAREN)
+	var args []ast.Expr
+	var ellipsis token.Pos
+	for p.tok != token.RPAREN && p.tok != token.EOF && !ellipsis.IsValid() {
+		args = append(args, p.parseExpr())
+		if p.tok == token.ELLIPSIS {
+			ellipsis = p.pos
+			p.next()
+		}
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	rparen := p.close(token.RPAREN)
+	return &ast.CallExpr{Fun: fun, Lparen: lparen, Args: args, Ellipsis: ellipsis, Rparen: rparen}
+}
+
+func (p *exprParser) parseIdent() *ast.Ident {
+	pos, name := p.pos, "_"
+	// keywords of go are plain names in expressions
+	if p.tok == token.IDENT || p.tok == IN || p.tok.IsKeyword() {
+		name = p.lit
+		p.next()
+	} else {
+		p.errorExpected("identifier")
+		p.next()
+	}
+	return &ast.Ident{NamePos: pos, Name: name}
+}
+
+func (p *exprParser) parseOperand() ast.Expr {
+	switch {
+	case p.tok == token.IDENT || p.tok.IsKeyword():
+		ident := p.parseIdent()
+		if p.tok == tokArrow {
+			return p.parseLambda(token.NoPos, []*ast.Ident{ident})
+		}
+		return ident
+	case p.tok.IsLiteral():
+		x := &ast.BasicLit{ValuePos: p.pos, Kind: p.tok, Value: p.lit}
+		p.next()
+		if p.tok == token.IDENT && p.pos == x.End() && (x.Kind == token.INT || x.Kind == token.FLOAT) {
+			return p.parseDuration(x)
+		}
+		return x
+	case p.tok == token.LPAREN:
+		return p.parseParenOrLambda()
+	case p.tok == token.LBRACK:
+		return p.parseListLit()
+	case p.tok == token.LBRACE:
+		return p.parseMapLit()
+	}
+	pos := p.pos
+	p.errorExpected("operand")
+	if p.tok != token.EOF {
+		p.next()
+	}
+	return &ast.BadExpr{From: pos, To: p.pos}
+}
+
+// parseDuration joins a number and the units written right after it
+func (p *exprParser) parseDuration(num *ast.BasicLit) ast.Expr {
+	value := num.Value + p.lit
+	p.next()
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		p.error(num.Pos(), "invalid duration "+value)
+	}
+	return &DurationLit{ValuePos: num.ValuePos, Value: value, Duration: d}
+}
+
+func (p *exprParser) parseListLit() ast.Expr {
+	lbrack := p.open(token.LBRACK)
+	var elts []ast.Expr
+	for p.tok != token.RBRACK && p.tok != token.EOF {
+		elts = append(elts, p.parseExpr())
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	rbrack := p.close(token.RBRACK)
+	return &ast.CompositeLit{Type: &ast.ArrayType{Lbrack: lbrack}, Lbrace: lbrack, Elts: elts, Rbrace: rbrack}
+}
+
+func (p *exprParser) parseMapLit() ast.Expr {
+	lbrace := p.open(token.LBRACE)
+	var elts []ast.Expr
+	for p.tok != token.RBRACE && p.tok != token.EOF {
+		key := p.parseExpr()
+		colon := p.expect(token.COLON)
+		value := p.parseExpr()
+		elts = append(elts, &ast.KeyValueExpr{Key: key, Colon: colon, Value: value})
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	rbrace := p.close(token.RBRACE)
+	return &ast.CompositeLit{Type: &ast.MapType{Map: lbrace}, Lbrace: lbrace, Elts: elts, Rbrace: rbrace}
+}
+
+func (p *exprParser) parseParenOrLambda() ast.Expr {
+	lparen := p.open(token.LPAREN)
+	var list []ast.Expr
+	for p.tok != token.RPAREN && p.tok != token.EOF {
+		list = append(list, p.parseExpr())
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	rparen := p.close(token.RPAREN)
+	if p.tok == tokArrow {
+		var params []*ast.Ident
+		for _, x := range list {
+			if ident, ok := x.(*ast.Ident); ok {
+				params = append(params, ident)
+			} else {
+				p.error(x.Pos(), "expected parameter name")
+			}
+		}
+		return p.parseLambda(lparen, params)
+	}
+	if len(list) != 1 {
+		p.error(lparen, "expected expression")
+		return &ast.BadExpr{From: lparen, To: rparen + 1}
+	}
+	return &ast.ParenExpr{Lparen: lparen, X: list[0], Rparen: rparen}
+}
+
+func (p *exprParser) parseLambda(lparen token.Pos, params []*ast.Ident) ast.Expr {
+	arrow := p.expect(tokArrow)
+	body := p.parseExpr()
+	return &LambdaExpr{Lparen: lparen, Params: params, Arrow: arrow, Body: body}
+}
+
+func (p *exprParser) parseStmtList() []ast.Stmt {
+	var list []ast.Stmt
+	for p.tok != token.RBRACE && p.tok != token.EOF {
+		if p.tok == token.SEMICOLON {
+			p.next()
+			continue
+		}
+		list = append(list, p.parseStmt())
+		if p.tok != token.SEMICOLON && p.tok != token.RBRACE && p.tok != token.EOF {
+			p.errorExpected("';' or newline")
+			p.next()
+		}
+	}
+	return list
+}
+
+func (p *exprParser) parseBlock() *ast.BlockStmt {
+	lbrace := p.expect(token.LBRACE)
+	list := p.parseStmtList()
+	rbrace := p.expect(token.RBRACE)
+	return &ast.BlockStmt{Lbrace: lbrace, List: list, Rbrace: rbrace}
+}
+
+func (p *exprParser) parseStmt() ast.Stmt {
+	switch p.tok {
+	case token.IF:
+		return p.parseIfStmt()
+	case token.FOR:
+		return p.parseForStmt()
+	case token.LBRACE:
+		return p.parseBlock()
+	}
+	x := p.parseExpr()
+	if p.tok == token.ASSIGN || p.tok == token.DEFINE {
+		pos, tok := p.pos, p.tok
+		switch x.(type) {
+		case *ast.Ident, *ast.SelectorExpr, *ast.IndexExpr:
+		default:
+			p.error(x.Pos(), "cannot assign to expression")
+		}
+		p.next()
+		y := p.parseExpr()
+		return &ast.AssignStmt{Lhs: []ast.Expr{x}, TokPos: pos, Tok: tok, Rhs: []ast.Expr{y}}
+	}
+	return &ast.ExprStmt{X: x}
+}
+
+func (p *exprParser) parseIfStmt() ast.Stmt {
+	pos := p.expect(token.IF)
+	cond := p.parseExpr()
+	body := p.parseBlock()
+	stmt := &ast.IfStmt{If: pos, Cond: cond, Body: body}
+	if p.tok == token.ELSE {
+		p.next()
+		if p.tok == token.IF {
+			stmt.Else = p.parseIfStmt()
+		} else {
+			stmt.Else = p.parseBlock()
+		}
+	}
+	return stmt
+}
+
+// parseForStmt parses for item in list {...} and for key, item in list {...}
+func (p *exprParser) parseForStmt() ast.Stmt {
+	pos := p.expect(token.FOR)
+	stmt := &ast.RangeStmt{For: pos, Tok: IN}
+	stmt.Value = p.parseIdent()
+	if p.tok == token.COMMA {
+		p.next()
+		stmt.Key = stmt.Value
+		stmt.Value = p.parseIdent()
+	}
+	stmt.TokPos = p.expect(IN)
+	stmt.X = p.parseExpr()
+	stmt.Body = p.parseBlock()
+	return stmt
+}
@@ -0,0 +1,86 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	_, err := ParseExpr("a + (b * c)")
+	assert.Equal(t, nil, err)
+
+	_, err = ParseExpr("a +")
+	assert.NotEqual(t, nil, err)
+
+	_, err = ParseExpr("a ? b")
+	assert.NotEqual(t, nil, err)
+
+	expr, err := ParseExpr("a ?? b ? c : d")
+	assert.Equal(t, nil, err)
+	_, ok := expr.(*CondExpr)
+	assert.Equal(t, true, ok)
+}
+
+func TestEvalOptionalOperators(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"user": map[string]any{
+			"name": "Allen",
+			"age":  21,
+			"address": map[string]any{
+				"city": "Paris",
+			},
+		},
+		"empty": nil,
+	})
+	cases := map[string]any{
+		"user?.address?.city":                "Paris",
+		"empty?.address?.city":               nil,
+		"user?.contact?.phone":               nil,
+		"empty?.getName()":                   nil,
+		"empty ?? 'anonymous'":               "anonymous",
+		"user.name ?? 'anonymous'":           "Allen",
+		"empty?.name ?? 'anonymous'":         "anonymous",
+		"user.age >= 18 ? 'adult' : 'minor'": "adult",
+		"user.age >= 30 ? 'old' : user.age >= 18 ? 'adult' : 'minor'": "adult",
+		"(user.age < 18 ? 'minor' : 'adult') + '!'":                   "adult!",
+		"user.age > 18 ?.5 : 1":                                       0.5,
+		"empty == nil ?.25 : user?.age":                               0.25,
+		".5 + 1_000.25":                                               1000.75,
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+}
+
+func TestEvalCollections(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"items": []int{1, 2, 3, 4},
+		"tags":  map[string]any{"a": 1, "b": 2},
+		"name":  "Allen",
+	})
+	cases := map[string]any{
+		"[1, 2, 3]":                      []any{int64(1), int64(2), int64(3)},
+		"[]":                             []any{},
+		"{'a': 1, 'b': 'x'}":             map[string]any{"a": int64(1), "b": "x"},
+		"{'a': [1]}.a[0]":                int64(1),
+		"items[1:3]":                     []int{2, 3},
+		"items[:2]":                      []int{1, 2},
+		"items[2:]":                      []int{3, 4},
+		"items[-1:]":                     []int{4},
+		"name[1:3]":                      "ll",
+		"[1, 2, 3][1:]":                  []any{int64(2), int64(3)},
+		"2 in items":                     true,
+		"5 in items":                     false,
+		"'a' in tags":                    true,
+		"'c' in tags":                    false,
+		"'ll' in name":                   true,
+		"2 in [1, 2] && 'x' in {'x': 0}": true,
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+}
@@ -0,0 +1,334 @@
+package evalx
+
+import (
+	"go/ast"
+	"go/token"
+	"math/big"
+)
+
+// Simplify folds the constant parts of expr: integer arithmetic, string
+// concatenation, comparisons, negations and the operators whose result is
+// decided by a constant left operand, like true || x or nil ?? x. Only what
+// gives the same result in every NumberMode is folded, so float arithmetic
+// and bit operations are kept as written, and so is anything that would
+// fail at run time. The returned tree shares the untouched nodes of expr,
+// which itself is never modified.
+func Simplify(expr ast.Expr) ast.Expr {
+	return simplify(expr)
+}
+
+// Normalize parses text and prints its simplified form back
+func Normalize(text string) (string, error) {
+	expr, err := exprOf(text, TopScope())
+	if err != nil {
+		return "", err
+	}
+	return Format(Simplify(expr)), nil
+}
+
+func simplify(input ast.Expr) ast.Expr {
+	switch expr := input.(type) {
+	case *ast.ParenExpr:
+		if x := simplify(expr.X); x != expr.X {
+			return &ast.ParenExpr{Lparen: expr.Lparen, X: x, Rparen: expr.Rparen}
+		}
+	case *ast.UnaryExpr:
+		x := simplify(expr.X)
+		if ret := foldUnary(expr, x); ret != nil {
+			return ret
+		} else if x != expr.X {
+			return &ast.UnaryExpr{OpPos: expr.OpPos, Op: expr.Op, X: x}
+		}
+	case *ast.BinaryExpr:
+		x, y := simplify(expr.X), simplify(expr.Y)
+		if ret := foldBinary(expr, x, y); ret != nil {
+			return ret
+		} else if x != expr.X || y != expr.Y {
+			return &ast.BinaryExpr{X: x, OpPos: expr.OpPos, Op: expr.Op, Y: y}
+		}
+	case *CondExpr:
+		cond, x, y := simplify(expr.Cond), simplify(expr.X), simplify(expr.Y)
+		if val, ok := constValueOf(cond); ok {
+			if truth, ok := val.(bool); ok && truth {
+				return x
+			} else if ok {
+				return y
+			}
+		}
+		if cond != expr.Cond || x != expr.X || y != expr.Y {
+			return &CondExpr{Cond: cond, Question: expr.Question, X: x, Colon: expr.Colon, Y: y}
+		}
+	case *ast.SelectorExpr:
+		if x := simplify(expr.X); x != expr.X {
+			return &ast.SelectorExpr{X: x, Sel: expr.Sel}
+		}
+	case *SafeSelectorExpr:
+		if x := simplify(expr.X); x != expr.X {
+			return &SafeSelectorExpr{X: x, Sel: expr.Sel}
+		}
+	case *ast.IndexExpr:
+		x, index := simplify(expr.X), simplify(expr.Index)
+		if x != expr.X || index != expr.Index {
+			return &ast.IndexExpr{X: x, Lbrack: expr.Lbrack, Index: index, Rbrack: expr.Rbrack}
+		}
+	case *ast.SliceExpr:
+		x, low, high := simplify(expr.X), simplifyOpt(expr.Low), simplifyOpt(expr.High)
+		if x != expr.X || low != expr.Low || high != expr.High {
+			ret := *expr
+			ret.X, ret.Low, ret.High = x, low, high
+			return &ret
+		}
+	case *ast.CallExpr:
+		fun := simplify(expr.Fun)
+		args, changed := simplifyList(expr.Args)
+		if fun != expr.Fun || changed {
+			ret := *expr
+			ret.Fun, ret.Args = fun, args
+			return &ret
+		}
+	case *ast.CompositeLit:
+		if elts, changed := simplifyList(expr.Elts); changed {
+			ret := *expr
+			ret.Elts = elts
+			return &ret
+		}
+	case *ast.KeyValueExpr:
+		key, value := simplify(expr.Key), simplify(expr.Value)
+		if key != expr.Key || value != expr.Value {
+			return &ast.KeyValueExpr{Key: key, Colon: expr.Colon, Value: value}
+		}
+	case *LambdaExpr:
+		if body := simplify(expr.Body); body != expr.Body {
+			return &LambdaExpr{Lparen: expr.Lparen, Params: expr.Params, Arrow: expr.Arrow, Body: body}
+		}
+	case *ScriptExpr:
+		if body := simplifyBlock(expr.Body); body != expr.Body {
+			return &ScriptExpr{Body: body}
+		}
+	}
+	return input
+}
+
+func simplifyOpt(expr ast.Expr) ast.Expr {
+	if expr == nil {
+		return nil
+	}
+	return simplify(expr)
+}
+
+func simplifyList(list []ast.Expr) ([]ast.Expr, bool) {
+	var ret []ast.Expr
+	for i, item := range list {
+		if tmp := simplify(item); tmp != item && ret == nil {
+			ret = append(make([]ast.Expr, 0, len(list)), list[:i]...)
+			ret = append(ret, tmp)
+		} else if ret != nil {
+			ret = append(ret, tmp)
+		}
+	}
+	if ret == nil {
+		return list, false
+	}
+	return ret, true
+}
+
+func simplifyBlock(block *ast.BlockStmt) *ast.BlockStmt {
+	var list []ast.Stmt
+	for i, stmt := range block.List {
+		if tmp := simplifyStmt(stmt); tmp != stmt && list == nil {
+			list = append(make([]ast.Stmt, 0, len(block.List)), block.List[:i]...)
+			list = append(list, tmp)
+		} else if list != nil {
+			list = append(list, tmp)
+		}
+	}
+	if list == nil {
+		return block
+	}
+	return &ast.BlockStmt{Lbrace: block.Lbrace, List: list, Rbrace: block.Rbrace}
+}
+
+func simplifyStmt(input ast.Stmt) ast.Stmt {
+	switch stmt := input.(type) {
+	case *ast.ExprStmt:
+		if x := simplify(stmt.X); x != stmt.X {
+			return &ast.ExprStmt{X: x}
+		}
+	case *ast.AssignStmt:
+		lhs, changed := simplifyList(stmt.Lhs)
+		rhs, rchanged := simplifyList(stmt.Rhs)
+		if changed || rchanged {
+			return &ast.AssignStmt{Lhs: lhs, TokPos: stmt.TokPos, Tok: stmt.Tok, Rhs: rhs}
+		}
+	case *ast.BlockStmt:
+		return simplifyBlock(stmt)
+	case *ast.IfStmt:
+		cond, body := simplify(stmt.Cond), simplifyBlock(stmt.Body)
+		var els ast.Stmt
+		if stmt.Else != nil {
+			els = simplifyStmt(stmt.Else)
+		}
+		if cond != stmt.Cond || body != stmt.Body || els != stmt.Else {
+			return &ast.IfStmt{If: stmt.If, Cond: cond, Body: body, Else: els}
+		}
+	case *ast.RangeStmt:
+		x, body := simplify(stmt.X), simplifyBlock(stmt.Body)
+		if x != stmt.X || body != stmt.Body {
+			ret := *stmt
+			ret.X, ret.Body = x, body
+			return &ret
+		}
+	}
+	return input
+}
+
+// constValueOf returns the value of a literal: a string, an integer that
+// fits int64, a bool or nil
+func constValueOf(input ast.Expr) (any, bool) {
+	switch expr := input.(type) {
+	case *ast.ParenExpr:
+		return constValueOf(expr.X)
+	case *ast.Ident:
+		return constOf(expr.Name)
+	case *ast.BasicLit:
+		switch expr.Kind {
+		case token.STRING, token.CHAR:
+			return evalBasicLit(expr), true
+		case token.INT:
+			// a literal counts only if native and big numbers read it alike
+			num, ok := new(big.Int).SetString(expr.Value, 0)
+			if ok && num.IsInt64() && evalBasicLit(expr) == any(num.Int64()) {
+				return num, true
+			}
+		}
+	case *ast.UnaryExpr:
+		if val, ok := constValueOf(expr.X); ok && expr.Op == token.SUB {
+			if num, ok := val.(*big.Int); ok {
+				return new(big.Int).Neg(num), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// literalOf writes val as a literal in the place of expr, the parentheses
+// keep the position of expr for the errors raised around it
+func literalOf(val any, expr ast.Expr) ast.Expr {
+	var ret ast.Expr
+	pos := expr.Pos()
+	switch tmp := val.(type) {
+	case nil:
+		ret = &ast.Ident{NamePos: pos, Name: "nil"}
+	case bool:
+		ret = &ast.Ident{NamePos: pos, Name: "false"}
+		if tmp {
+			ret = &ast.Ident{NamePos: pos, Name: "true"}
+		}
+	case string:
+		ret = &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: "\"" + tmp + "\""}
+	case *big.Int:
+		ret = &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: new(big.Int).Abs(tmp).String()}
+		if tmp.Sign() < 0 {
+			ret = &ast.UnaryExpr{OpPos: pos, Op: token.SUB, X: ret}
+		}
+	}
+	return &ast.ParenExpr{Lparen: pos, X: ret, Rparen: expr.End() - 1}
+}
+
+func foldUnary(expr *ast.UnaryExpr, x ast.Expr) ast.Expr {
+	val, ok := constValueOf(x)
+	if !ok {
+		return nil
+	}
+	switch tmp := val.(type) {
+	case bool:
+		if expr.Op == token.NOT {
+			return literalOf(!tmp, expr)
+		}
+	case *big.Int:
+		switch expr.Op {
+		case token.ADD:
+			return literalOf(tmp, expr)
+		case token.SUB:
+			if _, ok := x.(*ast.BasicLit); !ok {
+				return intLiteralOf(new(big.Int).Neg(tmp), expr)
+			}
+		}
+	}
+	return nil
+}
+
+func foldBinary(expr *ast.BinaryExpr, x, y ast.Expr) ast.Expr {
+	a, ok := constValueOf(x)
+	if !ok {
+		return nil
+	}
+	switch expr.Op {
+	case token.LOR, token.LAND:
+		if truth, ok := a.(bool); ok && truth == (expr.Op == token.LOR) {
+			return literalOf(truth, expr)
+		} else if ok {
+			if b, ok := constValueOf(y); ok {
+				if truth, ok := b.(bool); ok {
+					return literalOf(truth, expr)
+				}
+			}
+		}
+		return nil
+	case COALESCE:
+		if a == nil {
+			return y
+		}
+		return x
+	}
+	b, ok := constValueOf(y)
+	if !ok {
+		return nil
+	}
+	ia, intX := a.(*big.Int)
+	ib, intY := b.(*big.Int)
+	sa, strX := a.(string)
+	sb, strY := b.(string)
+	switch expr.Op {
+	case token.EQL, token.NEQ, token.GTR, token.LSS, token.GEQ, token.LEQ:
+		switch {
+		case intX && intY:
+			return literalOf(evalCmpBool(expr.Op, ia.Int64(), ib.Int64()), expr)
+		case strX && strY:
+			return literalOf(evalCmpBool(expr.Op, sa, sb), expr)
+		case expr.Op == token.EQL || expr.Op == token.NEQ:
+			_, boolX := a.(bool)
+			_, boolY := b.(bool)
+			if boolX && boolY || a == nil && b == nil {
+				return literalOf(evalCmpBool(expr.Op, a, b), expr)
+			}
+		}
+	case token.ADD:
+		switch {
+		case intX && intY:
+			return intLiteralOf(new(big.Int).Add(ia, ib), expr)
+		case strX && strY:
+			return literalOf(sa+sb, expr)
+		case strX && intY:
+			return literalOf(sa+ib.String(), expr)
+		case intX && strY:
+			return literalOf(ia.String()+sb, expr)
+		}
+	case token.SUB, token.MUL, token.REM:
+		// a quotient is left to run time, where it depends on the number mode
+		if !intX || !intY || ib.Sign() == 0 && expr.Op == token.REM {
+			return nil
+		}
+		return intLiteralOf(bigIntArithmetic(expr.Op, ia, ib).(*big.Int), expr)
+	}
+	return nil
+}
+
+// intLiteralOf folds num only if it fits int64, short of the minimum whose
+// magnitude doesn't
+func intLiteralOf(num *big.Int, expr ast.Expr) ast.Expr {
+	if !num.IsInt64() || num.Int64() == -1<<63 {
+		return nil
+	}
+	return literalOf(num, expr)
+}
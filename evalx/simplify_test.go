@@ -0,0 +1,75 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"60 * 60 * 24":                  "86400",
+		"\"prefix-\" + 'x'":             "'prefix-x'",
+		"'n' + 1 + 2":                   "'n12'",
+		"true || x":                     "true",
+		"false && x.y":                  "false",
+		"false || x":                    "false || x",
+		"nil ?? name":                   "name",
+		"'a' ?? name":                   "'a'",
+		"1 < 2 ? a : b":                 "a",
+		"'a' == 'b' || x":               "false || x",
+		"(a + b) * (2 + 3)":             "(a + b) * 5",
+		"a - (b - c)":                   "a - (b - c)",
+		"x * -(2 * 3)":                  "x * -6",
+		"-(-(5))":                       "5",
+		"1 / 0":                         "1 / 0",
+		"7 / 2":                         "7 / 2",
+		"0.1 + 0.2":                     "0.1 + 0.2",
+		"1 << 2":                        "1 << 2",
+		"9223372036854775807 + 1":       "9223372036854775807 + 1",
+		"f(1 + 1, xs...)":               "f(2, xs...)",
+		"map(xs, x -> x * (1 + 1))":     "map(xs, x -> x * 2)",
+		"(x -> x + 1)(2)":               "(x -> x + 1)(2)",
+		"{'k': [1 + 2, !true]}[k][1:]":  "{'k': [3, false]}[k][1:]",
+		"user?.name ?? \"it's\"":        "user?.name ?? \"it's\"",
+		"(a ? b : c) ? d : (e ? f : g)": "(a ? b : c) ? d : e ? f : g",
+		"a in [1, 2] && !(b > 1)":       "a in [1, 2] && !(b > 1)",
+		"((x, y) -> x + y) ?? (z -> z)": "((x, y) -> x + y) ?? (z -> z)",
+		"-x.y[0] + (-1) * +(y)":         "-x.y[0] + -1 * +y",
+		"elapsed > (1h30m)":             "elapsed > 1h30m",
+	}
+	for text, expect := range cases {
+		ret, err := Normalize(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+	_, err := Normalize("1 +")
+	assert.Equal(t, KindSyntax, err.(*EvalError).Kind)
+}
+
+func TestSimplify(t *testing.T) {
+	expr, _ := ParseExpr("x + 2 * 3")
+	ret := Simplify(expr)
+	assert.Equal(t, "x + 2 * 3", Format(expr))
+	assert.Equal(t, "x + 6", Format(ret))
+
+	script, _ := ParseScript("x = 1 + 2\nif x > 2 { y = 'a' + 'b' } else { y = 'c' }\nfor i in [1] { x = x + i }")
+	text := Format(Simplify(script))
+	assert.Equal(t, "x = 3; if x > 2 { y = 'ab' } else { y = 'c' }; for i in [1] { x = x + i }", text)
+	scope := NewScope()
+	ret2, err := scope.Exec(text)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(4), ret2)
+
+	opts := EvalOptions{Numbers: NumberDecimal}
+	val, err := EvalWith("60 * 60 * 24", nil, opts)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, big.NewInt(86400), val)
+
+	scope = NewScope(map[string]any{"v": int8(1)})
+	_, err = scope.EvalWith("v + (100 + 100)", EvalOptions{Typed: true})
+	assert.Equal(t, KindTypeMismatch, err.(*EvalError).Kind)
+	_, err = scope.EvalWith("1 + v / (2 - 2)", EvalOptions{})
+	assert.Equal(t, KindDivisionByZero, err.(*EvalError).Kind)
+	assert.Equal(t, "v / (2 - 2)", err.(*EvalError).Node)
+}
@@ -10,11 +10,13 @@ const (
 )
 
 type Stack struct {
-	Ctx    Context
-	Target datax.LinkedList[Target]
-	Error  error
-	X      any
-	Y      any
+	Ctx     Context
+	Options EvalOptions
+	limit   *limiter
+	Target  datax.LinkedList[Target]
+	Error   error
+	X       any
+	Y       any
 }
 
 func StackOf(accessor Context) *Stack {
@@ -31,3 +33,9 @@ func (it *Stack) PopTarget() Target {
 	}
 	return PROPERTY
 }
+
+// fork returns a stack evaluating against ctx with the same options and
+// limits
+func (it *Stack) fork(ctx Context) *Stack {
+	return &Stack{Ctx: ctx, Options: it.Options, limit: it.limit}
+}
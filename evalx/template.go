@@ -0,0 +1,119 @@
+package evalx
+
+import (
+	"errors"
+	"github.com/avicd/go-utilx/tokx"
+	"strings"
+)
+
+type MissingPolicy uint
+
+const (
+	// MissingEmpty renders a missing value as nothing
+	MissingEmpty MissingPolicy = iota
+	// MissingKeep renders the placeholder of a missing value as written
+	MissingKeep
+	// MissingError fails the rendering with a KindUndefined error
+	MissingError
+)
+
+type TemplateOptions struct {
+	// Left and Right delimit the placeholders, #{ and } if empty
+	Left  string
+	Right string
+	// Missing decides what an undefined identifier, member or index renders
+	// as, a nil value renders as nothing and other errors always fail the
+	// rendering
+	Missing MissingPolicy
+	// Eval is used to run the placeholders, Strict is always set
+	Eval EvalOptions
+}
+
+// Template is a text with placeholder expressions, compiled once and
+// rendered against any Context. A left delimiter preceded by a backslash is
+// written out as is, without the backslash, and so is either delimiter
+// inside a placeholder.
+type Template struct {
+	text  string
+	opts  TemplateOptions
+	texts []string
+	keys  []string
+	progs []*Program
+}
+
+func ParseTemplate(text string) (*Template, error) {
+	return ParseTemplateWith(text, TemplateOptions{})
+}
+
+func ParseTemplateWith(text string, opts TemplateOptions) (*Template, error) {
+	if opts.Left == "" {
+		opts.Left = "#{"
+	}
+	if opts.Right == "" {
+		opts.Right = "}"
+	}
+	opts.Eval.Strict = true
+	it := &Template{text: text, opts: opts}
+	unescapeText := strings.NewReplacer("\\"+opts.Left, opts.Left)
+	unescape := strings.NewReplacer("\\"+opts.Left, opts.Left, "\\"+opts.Right, opts.Right)
+	for i, part := range tokx.NewPair(opts.Left, opts.Right).Split(text) {
+		if i%2 == 0 {
+			it.texts = append(it.texts, unescapeText.Replace(part))
+			continue
+		}
+		prog, err := Compile(unescape.Replace(part))
+		if err != nil {
+			return nil, err
+		}
+		it.keys = append(it.keys, part)
+		it.progs = append(it.progs, prog)
+	}
+	return it, nil
+}
+
+func MustParseTemplate(text string) *Template {
+	tpl, err := ParseTemplate(text)
+	if err != nil {
+		panic(err)
+	}
+	return tpl
+}
+
+func (it *Template) String() string {
+	return it.text
+}
+
+func (it *Template) Render(ctx Context) (string, error) {
+	str := &strings.Builder{}
+	for i, text := range it.texts {
+		str.WriteString(text)
+		if i >= len(it.progs) {
+			break
+		}
+		val, err := it.progs[i].RunWith(ctx, it.opts.Eval)
+		if err != nil && !errors.Is(err, ErrMissing) {
+			return "", err
+		}
+		if err == nil {
+			if val != nil {
+				str.WriteString(stringOf(val))
+			}
+			continue
+		}
+		switch it.opts.Missing {
+		case MissingKeep:
+			str.WriteString(it.opts.Left + it.keys[i] + it.opts.Right)
+		case MissingError:
+			return "", err
+		}
+	}
+	return str.String(), nil
+}
+
+func (it *Template) MustRender(ctx Context) string {
+	ret, err := it.Render(ctx)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
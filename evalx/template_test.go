@@ -0,0 +1,75 @@
+package evalx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"user":  map[string]any{"name": "Amy", "nick": nil},
+		"total": 12.5,
+		"items": []string{"a", "b"},
+	})
+	scope.Bind("fmt", func(num float64, prec int64) string {
+		return fmt.Sprintf("%.*f", prec, num)
+	})
+	cases := map[string]string{
+		"Hello #{user.name}, you owe #{fmt(total, 2)}": "Hello Amy, you owe 12.50",
+		"#{join(items, ',')}#{len(items)}":             "a,b2",
+		"no placeholders":                              "no placeholders",
+		"\\#{user.name} is #{user.name}":               "#{user.name} is Amy",
+		"#{user.name == 'Amy' ? '\\}' : ''}":           "}",
+		"unclosed #{user.name":                         "unclosed #{user.name",
+		"{a\\} \\#{b\\}} #{'\\#{'}":                    "{a\\} #{b\\}} #{",
+	}
+	for text, expect := range cases {
+		tpl, err := ParseTemplate(text)
+		if assert.Equal(t, nil, err, text) {
+			ret, err := tpl.Render(scope)
+			assert.Equal(t, nil, err, text)
+			assert.Equal(t, expect, ret, text)
+		}
+	}
+
+	tpl := MustParseTemplate("[#{ user.age }][#{user.none}][#{ nil }]")
+	assert.Equal(t, "[][][]", tpl.MustRender(scope))
+	// a bound nil is not missing
+	tpl, _ = ParseTemplateWith("[#{ user.age }][#{ nil }][#{ user.nick }]", TemplateOptions{Missing: MissingKeep})
+	assert.Equal(t, "[#{ user.age }][][]", tpl.MustRender(scope))
+	tpl, _ = ParseTemplateWith("Hi #{user.nick}#{user.age}", TemplateOptions{Missing: MissingError})
+	_, err := tpl.Render(scope)
+	if assert.NotEqual(t, nil, err) {
+		assert.Equal(t, KindUndefined, err.(*EvalError).Kind)
+		assert.Equal(t, "user.age", err.(*EvalError).Node)
+	}
+	tpl, _ = ParseTemplateWith("Hi #{user.nick}", TemplateOptions{Missing: MissingError})
+	assert.Equal(t, "Hi ", tpl.MustRender(scope))
+
+	tpl, _ = ParseTemplateWith("Hello ${user.name}!", TemplateOptions{Left: "${"})
+	assert.Equal(t, "Hello Amy!", tpl.MustRender(scope))
+	tpl, _ = ParseTemplateWith("Hello {{ user.name }}", TemplateOptions{Left: "{{", Right: "}}"})
+	assert.Equal(t, "Hello Amy", tpl.MustRender(scope))
+
+	_, err = ParseTemplate("#{1 +}")
+	assert.NotEqual(t, nil, err)
+	_, err = MustParseTemplate("#{len(1)}").Render(scope)
+	assert.Equal(t, KindTypeMismatch, err.(*EvalError).Kind)
+
+	// a misspelled function is an error whatever the policy
+	for _, policy := range []MissingPolicy{MissingEmpty, MissingKeep} {
+		tpl, _ = ParseTemplateWith("Total: #{fmtt(total, 2)}", TemplateOptions{Missing: policy})
+		ret, err := tpl.Render(scope)
+		assert.Equal(t, "", ret)
+		if assert.NotEqual(t, nil, err) {
+			assert.Equal(t, KindUndefined, err.(*EvalError).Kind)
+			assert.False(t, errors.Is(err, ErrMissing))
+		}
+	}
+	_, err = MustParseTemplate("#{user.age}").Render(scope)
+	assert.Equal(t, nil, err)
+	_, err = scope.EvalWith("user.age", EvalOptions{Strict: true})
+	assert.True(t, errors.Is(err, ErrMissing))
+}
@@ -0,0 +1,157 @@
+package evalx
+
+import (
+	"errors"
+	"github.com/avicd/go-utilx/conv"
+	"github.com/avicd/go-utilx/refx"
+	"go/token"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// dateLayouts are tried in order by date called with a single argument
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	conv.DateTimeMircoZone,
+	conv.DateTimeMilliZone,
+	conv.DateTime + "Z07:00",
+	conv.DateTimeMirco,
+	conv.DateTimeMilli,
+	conv.DateTime,
+	conv.Date,
+}
+
+func isTime(val any) bool {
+	switch val.(type) {
+	case time.Time, time.Duration:
+		return true
+	}
+	return false
+}
+
+// builtinDate parses date(text) with the first of the dateLayouts that fits,
+// or date(layout, text), in the local time zone unless the text has one
+func builtinDate(args ...string) (time.Time, error) {
+	switch len(args) {
+	case 1:
+		for _, layout := range dateLayouts {
+			if ret, err := time.ParseInLocation(layout, args[0], time.Local); err == nil {
+				return ret, nil
+			}
+		}
+		return time.Time{}, errors.New("unknown date format " + args[0])
+	case 2:
+		return time.ParseInLocation(args[0], args[1], time.Local)
+	}
+	return time.Time{}, errors.New("want the text and optionally its layout")
+}
+
+// evalTime applies op on times and durations the way Go does, except that
+// dividing two durations gives their ratio as a float64
+func evalTime(op token.Token, x, y any) any {
+	switch a := x.(type) {
+	case time.Time:
+		switch b := y.(type) {
+		case time.Duration:
+			if op == token.ADD {
+				return a.Add(b)
+			} else if op == token.SUB {
+				return a.Add(-b)
+			}
+		case time.Time:
+			if op == token.SUB {
+				return a.Sub(b)
+			}
+		}
+	case time.Duration:
+		switch b := y.(type) {
+		case time.Time:
+			if op == token.ADD {
+				return b.Add(a)
+			}
+		case time.Duration:
+			switch op {
+			case token.ADD:
+				return a + b
+			case token.SUB:
+				return a - b
+			case token.QUO, token.REM:
+				if b == 0 {
+					panic(newError(KindDivisionByZero, "duration division by zero"))
+				} else if op == token.QUO {
+					return float64(a) / float64(b)
+				}
+				return a % b
+			}
+		default:
+			if isNumeric(b) && (op == token.MUL || op == token.QUO) {
+				return scaleDuration(op, a, b)
+			}
+		}
+	default:
+		if b, ok := y.(time.Duration); ok && isNumeric(x) && op == token.MUL {
+			return scaleDuration(op, b, x)
+		}
+	}
+	panic(newError(KindTypeMismatch, "invalid operation: %s %s %s", refx.TypeOf(x), tokenString(op), refx.TypeOf(y)))
+}
+
+// scaleDuration multiplies or divides a duration, exactly by an integer
+func scaleDuration(op token.Token, d time.Duration, num any) time.Duration {
+	if n, ok := bigIntOf(num); ok {
+		if n.Sign() == 0 && op == token.QUO {
+			panic(newError(KindDivisionByZero, "duration division by zero"))
+		}
+		ret := big.NewInt(int64(d))
+		if op == token.MUL {
+			ret.Mul(ret, n)
+		} else {
+			ret.Quo(ret, n)
+		}
+		return fitTo(ret, durationType, true).(time.Duration)
+	}
+	n := builtinFloat(num)
+	if op == token.MUL {
+		return time.Duration(float64(d) * n)
+	} else if n == 0 {
+		panic(newError(KindDivisionByZero, "duration division by zero"))
+	}
+	return time.Duration(float64(d) / n)
+}
+
+// timeResultType is the type of x op y if either is a time or a duration,
+// nil if the operation is invalid
+func timeResultType(op token.Token, x, y reflect.Type) (reflect.Type, bool) {
+	if x != timeType && x != durationType && y != timeType && y != durationType {
+		return nil, false
+	} else if isDynamic(x) || isDynamic(y) {
+		return anyType, true
+	}
+	numeric := func(tp reflect.Type) bool {
+		return refx.IsNumber(tp) && tp != durationType
+	}
+	switch {
+	case x == timeType && y == durationType && (op == token.ADD || op == token.SUB),
+		x == durationType && y == timeType && op == token.ADD:
+		return timeType, true
+	case x == timeType && y == timeType && op == token.SUB:
+		return durationType, true
+	case x == durationType && y == durationType:
+		switch op {
+		case token.ADD, token.SUB, token.REM:
+			return durationType, true
+		case token.QUO:
+			return floatType, true
+		}
+	case x == durationType && numeric(y) && (op == token.MUL || op == token.QUO),
+		numeric(x) && y == durationType && op == token.MUL:
+		return durationType, true
+	}
+	return nil, true
+}
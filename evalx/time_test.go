@@ -0,0 +1,84 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEval_Time(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	scope := NewScope(map[string]any{
+		"start":   start,
+		"end":     start.Add(90 * time.Minute),
+		"timeout": 30 * time.Second,
+	})
+	cases := map[string]any{
+		"5m":                                   5 * time.Minute,
+		"2h30m + 15s":                          2*time.Hour + 30*time.Minute + 15*time.Second,
+		"1.5h":                                 90 * time.Minute,
+		"-timeout":                             -30 * time.Second,
+		"end - start":                          90 * time.Minute,
+		"end - start > 1h":                     true,
+		"(end - start) / 1h":                   1.5,
+		"timeout * 2 == 1m":                    true,
+		"2 * timeout + 500ms":                  60*time.Second + 500*time.Millisecond,
+		"timeout / 4":                          7500 * time.Millisecond,
+		"start + 1h < end":                     true,
+		"end - 90m == start":                   true,
+		"1h + start == start + 60m":            true,
+		"start >= date('2024-03-01 12:00:00')": true,
+		"date('2006-01-02', '2024-03-02') - start":                          12 * time.Hour,
+		"date('2024-03-01T12:00:00Z') == date('2024-03-01 13:00:00+01:00')": true,
+		"duration('1h') == 60m":                                             true,
+		"'took ' + timeout":                                                 "took 30s",
+		"now() > start && since(start) > 1h":                                true,
+		"formatTime(start + 24h, 'Jan 2')":                                  "Mar 2",
+	}
+	for text, expect := range cases {
+		ret, err := scope.Eval(text)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+
+	ret, err := scope.EvalWith("2 * timeout + 0.5 * 1s", EvalOptions{Numbers: NumberDecimal})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 60*time.Second+500*time.Millisecond, ret)
+
+	errs := map[string]ErrorKind{
+		"start + end":   KindTypeMismatch,
+		"timeout / 0":   KindDivisionByZero,
+		"date('x')":     KindRuntime,
+		"5parsecs":      KindSyntax,
+		"'a' - timeout": KindTypeMismatch,
+	}
+	for text, kind := range errs {
+		_, err := scope.Eval(text)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, kind, err.(*EvalError).Kind, text)
+		}
+	}
+}
+
+func TestCheck_Time(t *testing.T) {
+	schema := map[string]any{"start": time.Time{}, "timeout": time.Duration(0)}
+	cases := map[string]any{
+		"start + timeout":    time.Time{},
+		"timeout * 2 / 1s":   0.0,
+		"-timeout < 5m":      true,
+		"date('2024-03-01')": time.Time{},
+		"start - now() + 1h": time.Duration(0),
+	}
+	for text, expect := range cases {
+		tp, err := Check(text, schema)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, reflect.TypeOf(expect), tp, text)
+	}
+	for _, text := range []string{"start + start", "timeout - start", "start > 1"} {
+		_, err := Check(text, schema)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, KindTypeMismatch, err.(*EvalError).Kind, text)
+		}
+	}
+}
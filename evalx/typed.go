@@ -0,0 +1,181 @@
+package evalx
+
+import (
+	"github.com/avicd/go-utilx/refx"
+	"go/ast"
+	"go/token"
+	"math/big"
+	"reflect"
+)
+
+// operands marks the operands of a binary expression that are untyped
+// integer constants, in Typed mode they take the type of the other operand
+type operands struct {
+	x bool
+	y bool
+}
+
+func operandsOf(expr *ast.BinaryExpr) operands {
+	return operands{x: isUntypedInt(expr.X), y: isUntypedInt(expr.Y)}
+}
+
+func isUntypedInt(input ast.Expr) bool {
+	switch expr := input.(type) {
+	case *ast.BasicLit:
+		return expr.Kind == token.INT
+	case *ast.ParenExpr:
+		return isUntypedInt(expr.X)
+	case *ast.UnaryExpr:
+		return expr.Op != token.NOT && isUntypedInt(expr.X)
+	case *ast.BinaryExpr:
+		switch expr.Op {
+		case token.SHL, token.SHR:
+			return isUntypedInt(expr.X)
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+			token.AND, token.OR, token.XOR, token.AND_NOT:
+			return isUntypedInt(expr.X) && isUntypedInt(expr.Y)
+		}
+	}
+	return false
+}
+
+func isTyped(opts *EvalOptions, x, y any) bool {
+	return (opts.Typed || opts.Overflow) && refx.IsGeneralInt(x) && refx.IsGeneralInt(y)
+}
+
+// evalTyped computes op exactly and fits the result into the type of the
+// operands, or int64 unless opts is Typed
+func evalTyped(op token.Token, x, y any, lits operands, opts *EvalOptions) any {
+	a, b := refx.Indirect(x), refx.Indirect(y)
+	typ := int64Type
+	if opts.Typed {
+		typ = typeOfOperands(op, a.Type(), b.Type(), lits)
+	}
+	ia, ib := exactOf(a), exactOf(b)
+	if opts.Typed && lits.x && !lits.y {
+		mustFit(ia, typ)
+	} else if opts.Typed && lits.y && !lits.x && op != token.SHL && op != token.SHR {
+		mustFit(ib, typ)
+	}
+	ret := new(big.Int)
+	switch op {
+	case token.ADD:
+		ret.Add(ia, ib)
+	case token.SUB:
+		ret.Sub(ia, ib)
+	case token.MUL:
+		ret.Mul(ia, ib)
+	case token.QUO, token.REM:
+		if ib.Sign() == 0 {
+			panic(newError(KindDivisionByZero, "integer division by zero"))
+		}
+		if op == token.QUO {
+			ret.Quo(ia, ib)
+		} else {
+			ret.Rem(ia, ib)
+		}
+	case token.AND:
+		ret.And(ia, ib)
+	case token.OR:
+		ret.Or(ia, ib)
+	case token.XOR:
+		ret.Xor(ia, ib)
+	case token.AND_NOT:
+		ret.AndNot(ia, ib)
+	case token.SHL, token.SHR:
+		if ib.Sign() < 0 {
+			panic(newError(KindRuntime, "negative shift amount %s", ib))
+		}
+		// any shift beyond 128 bits moves every bit out of a 64-bit type
+		count := uint(128)
+		if ib.IsUint64() && ib.Uint64() < 128 {
+			count = uint(ib.Uint64())
+		}
+		if op == token.SHL {
+			ret.Lsh(ia, count)
+		} else {
+			ret.Rsh(ia, count)
+		}
+	}
+	return fitTo(ret, typ, opts.Overflow)
+}
+
+// evalTypedUnary applies op to x in its own type
+func evalTypedUnary(op token.Token, x any, opts *EvalOptions) any {
+	switch op {
+	case token.SUB:
+		return evalTyped(token.SUB, int64(0), x, operands{x: true}, opts)
+	case token.XOR:
+		el := refx.Indirect(x)
+		typ := int64Type
+		if opts.Typed {
+			typ = el.Type()
+		}
+		return fitTo(new(big.Int).Not(exactOf(el)), typ, false)
+	}
+	return evalUnary(op, x)
+}
+
+func typeOfOperands(op token.Token, a, b reflect.Type, lits operands) reflect.Type {
+	switch {
+	case op == token.SHL || op == token.SHR:
+		if lits.x {
+			return int64Type
+		}
+		return a
+	case lits.x && lits.y:
+		return int64Type
+	case lits.x:
+		return b
+	case lits.y:
+		return a
+	case a != b:
+		panic(newError(KindTypeMismatch, "invalid operation: mismatched types %s and %s", a, b))
+	}
+	return a
+}
+
+func exactOf(val reflect.Value) *big.Int {
+	if val.CanInt() {
+		return big.NewInt(val.Int())
+	}
+	return new(big.Int).SetUint64(val.Uint())
+}
+
+func isSigned(typ reflect.Type) bool {
+	return typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Int64
+}
+
+func fits(num *big.Int, typ reflect.Type) bool {
+	bits := uint(typ.Bits())
+	if isSigned(typ) {
+		limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		return num.Cmp(new(big.Int).Neg(limit)) >= 0 && num.Cmp(limit) < 0
+	}
+	return num.Sign() >= 0 && num.BitLen() <= int(bits)
+}
+
+func mustFit(num *big.Int, typ reflect.Type) {
+	if !fits(num, typ) {
+		panic(newError(KindTypeMismatch, "constant %s overflows %s", num, typ))
+	}
+}
+
+// fitTo converts num to typ, wrapping around like Go does unless overflow
+// is to be reported
+func fitTo(num *big.Int, typ reflect.Type, overflow bool) any {
+	if !fits(num, typ) {
+		if overflow {
+			panic(newError(KindOverflow, "%s overflows %s", num, typ))
+		}
+		bits := uint(typ.Bits())
+		num.And(num, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), bits), big.NewInt(1)))
+		if isSigned(typ) && num.Bit(int(bits)-1) == 1 {
+			num.Sub(num, new(big.Int).Lsh(big.NewInt(1), bits))
+		}
+	}
+	if isSigned(typ) {
+		return reflect.ValueOf(num.Int64()).Convert(typ).Interface()
+	}
+	return reflect.ValueOf(num.Uint64()).Convert(typ).Interface()
+}
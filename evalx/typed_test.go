@@ -0,0 +1,77 @@
+package evalx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestEvalWith_Typed(t *testing.T) {
+	scope := NewScope(map[string]any{
+		"u8":  uint8(200),
+		"one": uint8(1),
+		"i8":  int8(-128),
+		"i32": int32(7),
+		"u":   uint(3),
+		"max": int64(math.MaxInt64),
+	})
+	opts := EvalOptions{Typed: true}
+	cases := map[string]any{
+		"u8 + one":       uint8(201),
+		"u8 + 100":       uint8(44),
+		"u8 * 2":         uint8(144),
+		"-one":           uint8(255),
+		"^one":           uint8(254),
+		"-i8":            int8(-128),
+		"i32 / 2":        int32(3),
+		"i32 & -2":       int32(6),
+		"i32 << 2":       int32(28),
+		"i8 >> 1":        int8(-64),
+		"u &^ 1":         uint(2),
+		"1 + 2":          int64(3),
+		"i32 + (1 << 3)": int32(15),
+		"max + 1":        int64(math.MinInt64),
+		"i32 + 0.5":      7.5,
+	}
+	for text, expect := range cases {
+		ret, err := scope.EvalWith(text, opts)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+
+	errs := map[string]ErrorKind{
+		"u8 + i32":  KindTypeMismatch,
+		"u8 + 300":  KindTypeMismatch,
+		"u8 / 0":    KindDivisionByZero,
+		"i32 << -1": KindRuntime,
+	}
+	for text, kind := range errs {
+		_, err := scope.EvalWith(text, opts)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, kind, err.(*EvalError).Kind, text)
+		}
+	}
+
+	ret, err := scope.EvalWith("u8 + one", EvalOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(201), ret)
+}
+
+func TestEvalWith_Overflow(t *testing.T) {
+	scope := NewScope(map[string]any{"u8": uint8(200), "max": int64(math.MaxInt64)})
+	cases := map[string]EvalOptions{
+		"max + 1":   {Overflow: true},
+		"max * max": {Overflow: true},
+		"u8 + 100":  {Typed: true, Overflow: true},
+		"-u8":       {Typed: true, Overflow: true},
+	}
+	for text, opts := range cases {
+		_, err := scope.EvalWith(text, opts)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, KindOverflow, err.(*EvalError).Kind, text)
+		}
+	}
+	ret, err := scope.EvalWith("u8 + 100", EvalOptions{Overflow: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(300), ret)
+}
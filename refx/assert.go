@@ -1,6 +1,7 @@
 package refx
 
 import (
+	"math/big"
 	"reflect"
 )
 
@@ -101,6 +102,15 @@ func IsNumber(vl any) bool {
 		kind >= reflect.Float32 && kind <= reflect.Float64
 }
 
+// IsBigNumber reports a big.Int, big.Float or big.Rat, or a pointer to one
+func IsBigNumber(vl any) bool {
+	switch vl.(type) {
+	case *big.Int, *big.Float, *big.Rat, big.Int, big.Float, big.Rat:
+		return true
+	}
+	return false
+}
+
 func IsInvalid(vl any) bool {
 	return KindOf(vl) == reflect.Invalid
 }
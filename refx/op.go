@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/avicd/go-utilx/conv"
 	"github.com/avicd/go-utilx/logx"
+	"math"
 	"math/big"
 	"reflect"
+	"time"
 )
 
 const (
@@ -456,7 +458,7 @@ func TypeOfField(vl any, props ...any) (reflect.Type, bool) {
 		switch buf.Kind() {
 		case reflect.Struct:
 			name := AsString(key)
-			if sf, ok := buf.FieldByName(name); ok {
+			if sf, ok := buf.FieldByName(name); ok && sf.IsExported() {
 				buf = sf.Type
 			} else {
 				return nil, false
@@ -637,7 +639,9 @@ func ForEach(target any, fn func(key any, val any)) {
 }
 
 func Cmp(x any, y any) int {
-	if IsNumber(x) && IsNumber(y) {
+	if IsBigNumber(x) && (IsBigNumber(y) || IsNumber(y)) || IsNumber(x) && IsBigNumber(y) {
+		return cmpBig(x, y)
+	} else if IsNumber(x) && IsNumber(y) {
 		return big.NewFloat(AsFloat64(x)).Cmp(big.NewFloat(AsFloat64(y)))
 	} else if IsString(x) && IsString(y) {
 		str1 := AsString(x)
@@ -649,8 +653,85 @@ func Cmp(x any, y any) int {
 		} else {
 			return CmpLss
 		}
+	} else if a, ok := x.(time.Time); ok {
+		if b, ok := y.(time.Time); ok {
+			return cmpTime(a, b)
+		}
 	} else if reflect.DeepEqual(x, y) {
 		return CmpEq
 	}
 	return CmpNeq
 }
+
+func cmpTime(a time.Time, b time.Time) int {
+	if a.Before(b) {
+		return CmpLss
+	} else if a.After(b) {
+		return CmpGtr
+	}
+	return CmpEq
+}
+
+// cmpBig compares exactly as rationals, unless one side is infinite
+func cmpBig(x any, y any) int {
+	if a, ok := ratOf(x); ok {
+		if b, ok := ratOf(y); ok {
+			return a.Cmp(b)
+		}
+	}
+	a, ok := bigFloatOf(x)
+	if !ok {
+		return CmpNeq
+	}
+	b, ok := bigFloatOf(y)
+	if !ok {
+		return CmpNeq
+	}
+	return a.Cmp(b)
+}
+
+func ratOf(vl any) (*big.Rat, bool) {
+	switch tmp := vl.(type) {
+	case *big.Rat:
+		return tmp, tmp != nil
+	case big.Rat:
+		return &tmp, true
+	case *big.Int:
+		return new(big.Rat).SetInt(tmp), tmp != nil
+	case big.Int:
+		return new(big.Rat).SetInt(&tmp), true
+	case *big.Float:
+		if tmp == nil || tmp.IsInf() {
+			return nil, false
+		}
+		ret, _ := tmp.Rat(nil)
+		return ret, true
+	case big.Float:
+		return ratOf(&tmp)
+	}
+	if IsGeneralInt(vl) {
+		if IsUInteger(vl) {
+			return new(big.Rat).SetInt(new(big.Int).SetUint64(AsUint64(vl))), true
+		}
+		return new(big.Rat).SetInt64(AsInt64(vl)), true
+	}
+	ret := new(big.Rat).SetFloat64(AsFloat64(vl))
+	return ret, ret != nil
+}
+
+func bigFloatOf(vl any) (*big.Float, bool) {
+	switch tmp := vl.(type) {
+	case *big.Float:
+		return tmp, tmp != nil
+	case big.Float:
+		return &tmp, true
+	}
+	if rat, ok := ratOf(vl); ok {
+		return new(big.Float).SetRat(rat), true
+	}
+	num := AsFloat64(vl)
+	if math.IsNaN(num) {
+		return nil, false
+	}
+	return big.NewFloat(num), true
+}
@@ -3,8 +3,11 @@ package refx
 import (
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"math"
+	"math/big"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type testOp struct {
@@ -328,6 +331,15 @@ func TestTypeOfField(t *testing.T) {
 	v0, exist = TypeOfField(p, "E", "E", "E")
 	assert.Equal(t, true, exist)
 	assert.Equal(t, reflect.Pointer, v0.Kind())
+
+	type hidden struct {
+		A string
+		b int
+	}
+	_, exist = TypeOfField(reflect.TypeOf(hidden{}), "b")
+	assert.Equal(t, false, exist)
+	_, exist = TypeOfField(hidden{}, "b")
+	assert.Equal(t, false, exist)
 }
 
 func TestPropOf(t *testing.T) {
@@ -376,3 +388,27 @@ func TestSet(t *testing.T) {
 	ok := Set(&list0, "A", 2)
 	assert.Equal(t, true, ok)
 }
+
+func TestCmp(t *testing.T) {
+	cases := []struct {
+		x   any
+		y   any
+		cmp int
+	}{
+		{1, 2.5, CmpLss},
+		{"b", "a", CmpGtr},
+		{big.NewInt(3), 3, CmpEq},
+		{big.NewInt(3), 2.5, CmpGtr},
+		{big.NewRat(3, 10), 0.3, CmpGtr},
+		{big.NewRat(1, 3), big.NewFloat(0.3), CmpGtr},
+		{big.NewFloat(math.Inf(1)), big.NewRat(1, 1), CmpGtr},
+		{new(big.Int).Lsh(big.NewInt(1), 64), uint64(math.MaxUint64), CmpGtr},
+		{big.NewInt(1), "1", CmpNeq},
+		{time.Unix(1, 0), time.Unix(2, 0), CmpLss},
+		{time.Unix(1, 0).UTC(), time.Unix(1, 0).In(time.FixedZone("x", 3600)), CmpEq},
+		{time.Unix(1, 0), 1, CmpNeq},
+	}
+	for _, item := range cases {
+		assert.Equal(t, item.cmp, Cmp(item.x, item.y), "%v, %v", item.x, item.y)
+	}
+}
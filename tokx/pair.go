@@ -74,3 +74,40 @@ func (it *Pair) Map(text string, rel func(s string) string) string {
 	}
 	return str.String()
 }
+
+// Split cuts text into the text outside the pairs and the keys within them,
+// keys are at the odd indices. Escaped delimiters are kept as they are and an
+// unclosed pair is left in the text.
+func (it *Pair) Split(text string) []string {
+	var parts []string
+	buf := text
+	left := false
+	expect := it.left
+	str := &strings.Builder{}
+	for {
+		si := strings.Index(buf, expect)
+		if si < 0 {
+			break
+		} else if si > 0 && buf[si-1] == '\\' {
+			str.WriteString(buf[:si+len(expect)])
+			buf = buf[si+len(expect):]
+			continue
+		}
+		str.WriteString(buf[:si])
+		parts = append(parts, str.String())
+		str.Reset()
+		buf = buf[si+len(expect):]
+		if left {
+			expect = it.left
+		} else {
+			expect = it.right
+		}
+		left = !left
+	}
+	str.WriteString(buf)
+	if left {
+		last := len(parts) - 1
+		return append(parts[:last], parts[last]+it.left+str.String())
+	}
+	return append(parts, str.String())
+}
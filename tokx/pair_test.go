@@ -24,3 +24,18 @@ func TestPairToken_Map(t *testing.T) {
 	assert.Equal(t, val, "INSERT INTO USER(name,age,height) VALUES(?,?,?)")
 	assert.Equal(t, true, reflect.DeepEqual(list, []string{"name", "age", "height"}))
 }
+
+func TestPair_Split(t *testing.T) {
+	pair := NewPair("#{", "}")
+	cases := map[string][]string{
+		"":                {""},
+		"plain":           {"plain"},
+		"a #{b} c #{d}":   {"a ", "b", " c ", "d", ""},
+		"\\#{a} #{b\\}c}": {"\\#{a} ", "b\\}c", ""},
+		"a #{b} #{c":      {"a ", "b", " #{c"},
+		"#{a}#{b}":        {"", "a", "", "b", ""},
+	}
+	for text, expect := range cases {
+		assert.Equal(t, expect, pair.Split(text), text)
+	}
+}
@@ -0,0 +1,177 @@
+package xmlx
+
+// isNamespaceDecl tells if an attribute declares a namespace
+func isNamespaceDecl(attr *Node) bool {
+	return attr.Prefix == xmlnsPrefix || attr.Prefix == "" && attr.Name == xmlnsPrefix
+}
+
+// matches tells if a node passes the node test, a name test only matches
+// the principal node type of the axis
+func (test nodeTest) matches(node *Node, principal NodeType) bool {
+	switch test.kind {
+	case "node":
+		return node.Type != DocumentTypeNode && node.Type != DirectiveNode
+	case "text":
+		return node.Type == TextNode || node.Type == CDataSectionNode
+	case "comment":
+		return node.Type == CommentNode
+	case "processing-instruction":
+		return node.Type == ProcessingInstructionNode && (test.target == "" || test.target == node.Name)
+	}
+	if node.Type != principal {
+		return false
+	} else if test.bound {
+		if test.uri != node.NamespaceURI {
+			return false
+		}
+	} else if test.prefix != "" && test.prefix != node.Prefix {
+		return false
+	}
+	return test.local == "" || test.local == node.Name
+}
+
+// axisOf is the nodes on the axis from node that pass the test, in
+// document order or in reverse for the reverse axes
+func axisOf(axis string, node *Node, test nodeTest) []*Node {
+	var list []*Node
+	principal := ElementNode
+	add := func(p *Node) {
+		if test.matches(p, principal) {
+			list = append(list, p)
+		}
+	}
+	switch axis {
+	case "self":
+		add(node)
+	case "child":
+		for _, p := range node.ChildNodes {
+			add(p)
+		}
+	case "descendant", "descendant-or-self":
+		if axis == "descendant-or-self" {
+			add(node)
+		}
+		walkDescendants(node, add)
+	case "parent":
+		if node.ParentNode != nil {
+			add(node.ParentNode)
+		}
+	case "ancestor", "ancestor-or-self":
+		if axis == "ancestor-or-self" {
+			add(node)
+		}
+		for p := node.ParentNode; p != nil; p = p.ParentNode {
+			add(p)
+		}
+	case "following-sibling":
+		if node.Type != AttributeNode {
+			for _, p := range siblingsOf(node, true) {
+				add(p)
+			}
+		}
+	case "preceding-sibling":
+		if node.Type != AttributeNode {
+			for _, p := range siblingsOf(node, false) {
+				add(p)
+			}
+		}
+	case "following":
+		if node.Type == AttributeNode && node.ParentNode != nil {
+			node = node.ParentNode
+			walkDescendants(node, add)
+		}
+		for p := node; p != nil; p = p.ParentNode {
+			for _, s := range siblingsOf(p, true) {
+				add(s)
+				walkDescendants(s, add)
+			}
+		}
+	case "preceding":
+		if node.Type == AttributeNode && node.ParentNode != nil {
+			node = node.ParentNode
+		}
+		for p := node; p != nil; p = p.ParentNode {
+			for _, s := range siblingsOf(p, false) {
+				var sub []*Node
+				walkDescendants(s, func(n *Node) {
+					sub = append(sub, n)
+				})
+				for i := len(sub) - 1; i >= 0; i-- {
+					add(sub[i])
+				}
+				add(s)
+			}
+		}
+	case "attribute":
+		principal = AttributeNode
+		for _, attr := range node.Attrs {
+			if node.Type == ElementNode && !isNamespaceDecl(attr) {
+				add(attr)
+			}
+		}
+	case "namespace":
+		// a name test matches the prefix a namespace node declares
+		if node.Type == ElementNode {
+			for _, attr := range namespacesOf(node) {
+				if test.kind != "" && test.matches(attr, AttributeNode) ||
+					test.kind == "" && (test.local == "" || test.local == declaredPrefix(attr)) {
+					list = append(list, attr)
+				}
+			}
+		}
+	}
+	return list
+}
+
+func walkDescendants(node *Node, visit func(node *Node)) {
+	for _, p := range node.ChildNodes {
+		visit(p)
+		walkDescendants(p, visit)
+	}
+}
+
+// siblingsOf is the siblings after node, or before it from the nearest
+func siblingsOf(node *Node, after bool) []*Node {
+	if node.ParentNode == nil || node.Type == AttributeNode {
+		return nil
+	}
+	list := node.ParentNode.ChildNodes
+	index := node.ParentNode.IndexOf(node)
+	if index < 0 {
+		return nil
+	} else if after {
+		return list[index+1:]
+	}
+	var ret []*Node
+	for i := index - 1; i >= 0; i-- {
+		ret = append(ret, list[i])
+	}
+	return ret
+}
+
+// declaredPrefix is the prefix a namespace declaration binds, "" for the
+// default namespace
+func declaredPrefix(attr *Node) string {
+	if attr.Prefix == xmlnsPrefix {
+		return attr.Name
+	}
+	return ""
+}
+
+// namespacesOf is the namespace declarations in scope of an element, the
+// nearest for each prefix
+func namespacesOf(node *Node) []*Node {
+	var list []*Node
+	seen := map[string]bool{}
+	for p := node; p != nil; p = p.ParentNode {
+		for _, attr := range p.Attrs {
+			if prefix := declaredPrefix(attr); isNamespaceDecl(attr) && !seen[prefix] {
+				seen[prefix] = true
+				if attr.Value != "" {
+					list = append(list, attr)
+				}
+			}
+		}
+	}
+	return list
+}
@@ -1,11 +1,5 @@
 package xmlx
 
-import (
-	"github.com/avicd/go-utilx/refx"
-	"go/ast"
-	"strings"
-)
-
 type SelectType uint
 
 const (
@@ -13,79 +7,42 @@ const (
 	SelectFirst
 )
 
+// xpathContext is the context an expression is evaluated in: the context
+// node with its position in a node-set of size
 type xpathContext struct {
-	binds map[string]any
-	xnd   *XNode
-}
-
-func newEvalCtx(xnd *XNode) *xpathContext {
-	ctx := &xpathContext{binds: map[string]any{}, xnd: xnd}
-	ctx.bind("self", xnd)
-	return ctx
-}
-
-func (ctx *xpathContext) bind(name string, value any) {
-	ctx.binds[name] = value
-}
-
-func (ctx *xpathContext) ValueOf(ident string) (any, bool) {
-	if val, ok := ctx.binds[ident]; ok {
-		return val, ok
-	}
-	if strings.HasPrefix(ident, xpathAttr) {
-		ident = strings.TrimPrefix(ident, xpathAttr)
-		return ctx.xnd.AttrString(ident), true
-	} else {
-		var target *Node
-		xnd := NewXpathNode(ctx.xnd.Node)
-		xnd.setCheckin(func(node *Node) bool {
-			target = node
-			return false
-		})
-		xnd.Child(ident)
-		if target != nil {
-			return target.InnerText(), true
-		}
-	}
-	return nil, false
+	node  *Node
+	pos   int
+	size  int
+	order docOrder
+	expr  string
 }
 
-func (ctx *xpathContext) MethodOf(ident string) (any, bool) {
-	return refx.MethodOfId(ctx.xnd, ident)
+func (ctx *xpathContext) at(node *Node, pos int, size int) *xpathContext {
+	return &xpathContext{node: node, pos: pos, size: size, order: ctx.order, expr: ctx.expr}
 }
 
-func (ctx *xpathContext) CacheOf(text string) (ast.Expr, bool) {
-	return nil, false
+func (ctx *xpathContext) fail(pos int, msg string) {
+	panic(&XpathError{Expr: ctx.expr, Pos: pos, Msg: msg})
 }
 
-func (ctx *xpathContext) Cache(text string, expr ast.Expr) {
+// docOrder numbers the nodes of the trees met in document order, the
+// attributes of an element come after it and before its children
+type docOrder map[*Node]int
 
-}
-
-// parent->child->index
-type indexPool struct {
-	cache map[*Node]map[*Node]int
-}
-
-func (c *indexPool) cacheIndex(node *Node) {
-	pool := c.cache[node.ParentNode]
-	if pool == nil {
-		pool = map[*Node]int{}
-		c.cache[node.ParentNode] = pool
-	}
-	if _, ok := pool[node]; !ok {
-		pool[node] = len(pool) + 1
+func (order docOrder) indexOf(node *Node) int {
+	if index, ok := order[node]; ok {
+		return index
 	}
-}
-
-func (c *indexPool) GetIndex(node *Node) int {
-	pool := c.cache[node.ParentNode]
-	if pool == nil {
-		pool = map[*Node]int{}
-		c.cache[node.ParentNode] = pool
-	}
-	if val, ok := pool[node]; ok {
-		return val
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		order[node] = len(order)
+		for _, attr := range node.Attrs {
+			order[attr] = len(order)
+		}
+		for _, p := range node.ChildNodes {
+			walk(p)
+		}
 	}
-	return -1
+	walk(node.GetRoot())
+	return order[node]
 }
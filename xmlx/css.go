@@ -0,0 +1,560 @@
+package xmlx
+
+import (
+	"fmt"
+	"github.com/avicd/go-utilx/bufx"
+	"strconv"
+	"strings"
+)
+
+var selectorCache = &bufx.LruCache[string, *Selector]{Size: 100}
+
+// Selector is a compiled group of CSS selectors, it matches the elements
+// any of them matches. Type selectors ignore case.
+type Selector struct {
+	list []*complexSel
+	text string
+}
+
+// complexSel is compounds joined by combinators, combs[i] joins parts[i]
+// to parts[i+1] and is one of ' ', '>', '+' and '~'
+type complexSel struct {
+	parts []*compoundSel
+	combs []byte
+}
+
+type compoundSel struct {
+	tag     string
+	ids     []string
+	classes []string
+	attrs   []*attrSel
+	pseudos []*pseudoSel
+}
+
+type attrSel struct {
+	name  string
+	op    string
+	value string
+	fold  bool
+}
+
+// pseudoSel is a pseudo-class, the nth ones match the positions a*n+b
+type pseudoSel struct {
+	name string
+	a, b int
+	not  []*complexSel
+}
+
+// SelectorError is a syntax error of a CSS selector
+type SelectorError struct {
+	Selector string
+	Pos      int
+	Msg      string
+}
+
+func (e *SelectorError) Error() string {
+	return fmt.Sprintf("xmlx: %s at position %d in selector %q", e.Msg, e.Pos, e.Selector)
+}
+
+// NewSelector compiles a CSS selector group like "ul > li.item, a[href^=http]"
+func NewSelector(text string) (*Selector, error) {
+	p := &cssParser{text: text}
+	var list []*complexSel
+	err := p.try(func() {
+		list = p.parseList()
+		if p.offset < len(p.text) {
+			p.fail("unexpected %q", p.text[p.offset])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Selector{list: list, text: text}, nil
+}
+
+// compileSelector is NewSelector with the compiled selectors cached
+func compileSelector(text string) (*Selector, error) {
+	if sel, ok := selectorCache.Get(text); ok {
+		return sel, nil
+	}
+	sel, err := NewSelector(text)
+	if err != nil {
+		return nil, err
+	}
+	selectorCache.Put(text, sel)
+	return sel, nil
+}
+
+// Match tells if the selector matches an element
+func (it *Selector) Match(node *Node) bool {
+	return node.Type == ElementNode && matchList(it.list, node)
+}
+
+// SelectFirst is the first element under node in document order the
+// selector matches
+func (it *Selector) SelectFirst(node *Node) *Node {
+	var ret *Node
+	walkElements(node, func(p *Node) bool {
+		if it.Match(p) {
+			ret = p
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+// SelectAll is the elements under node the selector matches, in document
+// order
+func (it *Selector) SelectAll(node *Node) []*Node {
+	var list []*Node
+	walkElements(node, func(p *Node) bool {
+		if it.Match(p) {
+			list = append(list, p)
+		}
+		return true
+	})
+	return list
+}
+
+// walkElements visits the elements under node until visit returns false
+func walkElements(node *Node, visit func(node *Node) bool) bool {
+	for _, p := range node.ChildNodes {
+		if p.Type != ElementNode {
+			continue
+		}
+		if !visit(p) || !walkElements(p, visit) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchList(list []*complexSel, node *Node) bool {
+	for _, sel := range list {
+		if sel.match(node, len(sel.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// match tells if node matches parts[index] and what is left of it
+func (sel *complexSel) match(node *Node, index int) bool {
+	if !sel.parts[index].match(node) {
+		return false
+	} else if index == 0 {
+		return true
+	}
+	switch sel.combs[index-1] {
+	case '>':
+		parent := parentElement(node)
+		return parent != nil && sel.match(parent, index-1)
+	case '+':
+		prev := prevElement(node)
+		return prev != nil && sel.match(prev, index-1)
+	case '~':
+		for p := prevElement(node); p != nil; p = prevElement(p) {
+			if sel.match(p, index-1) {
+				return true
+			}
+		}
+	default:
+		for p := parentElement(node); p != nil; p = parentElement(p) {
+			if sel.match(p, index-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parentElement(node *Node) *Node {
+	if node.ParentNode != nil && node.ParentNode.Type == ElementNode {
+		return node.ParentNode
+	}
+	return nil
+}
+
+func prevElement(node *Node) *Node {
+	for _, p := range siblingsOf(node, false) {
+		if p.Type == ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+func (sel *compoundSel) match(node *Node) bool {
+	if sel.tag != "" && !strings.EqualFold(sel.tag, node.Name) {
+		return false
+	}
+	for _, id := range sel.ids {
+		if node.AttrString("id") != id {
+			return false
+		}
+	}
+	if len(sel.classes) > 0 {
+		classes := strings.Fields(node.AttrString("class"))
+		for _, class := range sel.classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, attr := range sel.attrs {
+		if !attr.match(node) {
+			return false
+		}
+	}
+	for _, pseudo := range sel.pseudos {
+		if !pseudo.match(node) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, text string) bool {
+	for _, p := range list {
+		if p == text {
+			return true
+		}
+	}
+	return false
+}
+
+func (sel *attrSel) match(node *Node) bool {
+	attr := node.Attr(sel.name)
+	if attr == nil {
+		return false
+	} else if sel.op == "" {
+		return true
+	}
+	have, want := attr.Value, sel.value
+	if sel.fold {
+		have, want = strings.ToLower(have), strings.ToLower(want)
+	}
+	switch sel.op {
+	case "=":
+		return have == want
+	case "~=":
+		return containsString(strings.Fields(have), want)
+	case "|=":
+		return have == want || strings.HasPrefix(have, want+"-")
+	case "^=":
+		return want != "" && strings.HasPrefix(have, want)
+	case "$=":
+		return want != "" && strings.HasSuffix(have, want)
+	}
+	// *=
+	return want != "" && strings.Contains(have, want)
+}
+
+func (sel *pseudoSel) match(node *Node) bool {
+	switch sel.name {
+	case "not":
+		return !matchList(sel.not, node)
+	case "root":
+		return parentElement(node) == nil
+	case "empty":
+		for _, p := range node.ChildNodes {
+			if p.Type == ElementNode || p.Type == TextNode && p.Value != "" || p.Type == CDataSectionNode {
+				return false
+			}
+		}
+		return true
+	}
+	ofType := strings.HasSuffix(sel.name, "-of-type")
+	before, after := 0, 0
+	if node.ParentNode != nil {
+		seen := false
+		for _, p := range node.ParentNode.ChildNodes {
+			if p == node {
+				seen = true
+			} else if p.Type == ElementNode && (!ofType || strings.EqualFold(p.Name, node.Name)) {
+				if seen {
+					after++
+				} else {
+					before++
+				}
+			}
+		}
+	}
+	switch sel.name {
+	case "first-child", "first-of-type":
+		return before == 0
+	case "last-child", "last-of-type":
+		return after == 0
+	case "only-child", "only-of-type":
+		return before == 0 && after == 0
+	case "nth-child", "nth-of-type":
+		return sel.nth(before + 1)
+	}
+	// nth-last-child, nth-last-of-type
+	return sel.nth(after + 1)
+}
+
+// nth tells if pos is a*n+b for some n >= 0
+func (sel *pseudoSel) nth(pos int) bool {
+	if sel.a == 0 {
+		return pos == sel.b
+	}
+	diff := pos - sel.b
+	return diff%sel.a == 0 && diff/sel.a >= 0
+}
+
+type cssParser struct {
+	text   string
+	offset int
+}
+
+func (p *cssParser) try(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if se, ok := r.(*SelectorError); ok {
+				err = se
+				return
+			}
+			panic(r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+func (p *cssParser) fail(format string, args ...any) {
+	panic(&SelectorError{Selector: p.text, Pos: p.offset, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *cssParser) peek() byte {
+	if p.offset < len(p.text) {
+		return p.text[p.offset]
+	}
+	return 0
+}
+
+func (p *cssParser) skipSpace() bool {
+	start := p.offset
+	for p.offset < len(p.text) && strings.IndexByte(" \t\r\n\f", p.text[p.offset]) >= 0 {
+		p.offset++
+	}
+	return p.offset > start
+}
+
+func (p *cssParser) expect(ch byte) {
+	if p.peek() != ch {
+		if p.offset >= len(p.text) {
+			p.fail("unexpected end, want %q", ch)
+		}
+		p.fail("unexpected %q, want %q", p.peek(), ch)
+	}
+	p.offset++
+}
+
+func isIdentByte(ch byte) bool {
+	return ch == '-' || ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' ||
+		ch >= '0' && ch <= '9' || ch >= 0x80
+}
+
+// parseIdent reads an identifier, a '\' escapes the character after it
+func (p *cssParser) parseIdent() string {
+	buf := &strings.Builder{}
+	for p.offset < len(p.text) {
+		ch := p.text[p.offset]
+		if ch == '\\' && p.offset+1 < len(p.text) {
+			buf.WriteByte(p.text[p.offset+1])
+			p.offset += 2
+		} else if isIdentByte(ch) {
+			buf.WriteByte(ch)
+			p.offset++
+		} else {
+			break
+		}
+	}
+	if buf.Len() == 0 {
+		if p.offset >= len(p.text) {
+			p.fail("unexpected end, want a name")
+		}
+		p.fail("unexpected %q, want a name", p.peek())
+	}
+	return buf.String()
+}
+
+func (p *cssParser) parseList() []*complexSel {
+	var list []*complexSel
+	for {
+		p.skipSpace()
+		list = append(list, p.parseComplex())
+		if p.peek() != ',' {
+			return list
+		}
+		p.offset++
+	}
+}
+
+func (p *cssParser) parseComplex() *complexSel {
+	sel := &complexSel{parts: []*compoundSel{p.parseCompound()}}
+	for {
+		space := p.skipSpace()
+		ch := p.peek()
+		switch {
+		case ch == '>' || ch == '+' || ch == '~':
+			p.offset++
+			p.skipSpace()
+		case space && ch != ',' && ch != ')' && ch != 0:
+			ch = ' '
+		default:
+			return sel
+		}
+		sel.combs = append(sel.combs, ch)
+		sel.parts = append(sel.parts, p.parseCompound())
+	}
+}
+
+func (p *cssParser) parseCompound() *compoundSel {
+	sel := &compoundSel{}
+	start := p.offset
+	if p.peek() == '*' {
+		p.offset++
+	} else if isIdentByte(p.peek()) || p.peek() == '\\' {
+		sel.tag = p.parseIdent()
+	}
+	for {
+		switch p.peek() {
+		case '#':
+			p.offset++
+			sel.ids = append(sel.ids, p.parseIdent())
+		case '.':
+			p.offset++
+			sel.classes = append(sel.classes, p.parseIdent())
+		case '[':
+			p.offset++
+			sel.attrs = append(sel.attrs, p.parseAttr())
+		case ':':
+			p.offset++
+			sel.pseudos = append(sel.pseudos, p.parsePseudo())
+		default:
+			if p.offset == start {
+				if p.offset >= len(p.text) {
+					p.fail("unexpected end, want a selector")
+				}
+				p.fail("unexpected %q, want a selector", p.peek())
+			}
+			return sel
+		}
+	}
+}
+
+func (p *cssParser) parseAttr() *attrSel {
+	p.skipSpace()
+	sel := &attrSel{name: p.parseIdent()}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.offset++
+		return sel
+	}
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.text[p.offset:], op) {
+			sel.op = op
+			p.offset += len(op)
+			break
+		}
+	}
+	if sel.op == "" {
+		p.fail("unexpected %q, want an attribute operator", p.peek())
+	}
+	p.skipSpace()
+	if ch := p.peek(); ch == '"' || ch == '\'' {
+		end := strings.IndexByte(p.text[p.offset+1:], ch)
+		if end < 0 {
+			p.fail("unterminated string")
+		}
+		sel.value = p.text[p.offset+1 : p.offset+1+end]
+		p.offset += end + 2
+	} else {
+		sel.value = p.parseIdent()
+	}
+	p.skipSpace()
+	if ch := p.peek(); ch == 'i' || ch == 'I' {
+		sel.fold = true
+		p.offset++
+		p.skipSpace()
+	} else if ch == 's' || ch == 'S' {
+		p.offset++
+		p.skipSpace()
+	}
+	p.expect(']')
+	return sel
+}
+
+func (p *cssParser) parsePseudo() *pseudoSel {
+	if p.peek() == ':' {
+		p.fail("pseudo-elements are not supported")
+	}
+	start := p.offset
+	sel := &pseudoSel{name: strings.ToLower(p.parseIdent())}
+	switch sel.name {
+	case "root", "empty", "first-child", "last-child", "only-child",
+		"first-of-type", "last-of-type", "only-of-type":
+	case "not":
+		p.expect('(')
+		sel.not = p.parseList()
+		p.skipSpace()
+		p.expect(')')
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		p.expect('(')
+		end := strings.IndexByte(p.text[p.offset:], ')')
+		if end < 0 {
+			p.offset = len(p.text)
+			p.fail("unexpected end, want ')'")
+		}
+		a, b, ok := parseNth(p.text[p.offset : p.offset+end])
+		if !ok {
+			p.fail("invalid argument of :%s", sel.name)
+		}
+		sel.a, sel.b = a, b
+		p.offset += end + 1
+	default:
+		p.offset = start
+		p.fail("unknown pseudo-class :%s", sel.name)
+	}
+	return sel
+}
+
+// parseNth reads the an+b argument of the nth pseudo-classes, or odd and
+// even
+func parseNth(text string) (int, int, bool) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), ""))
+	switch text {
+	case "odd":
+		return 2, 1, true
+	case "even":
+		return 2, 0, true
+	case "":
+		return 0, 0, false
+	}
+	before, after, ok := strings.Cut(text, "n")
+	if !ok {
+		b, err := strconv.Atoi(text)
+		return 0, b, err == nil
+	}
+	a := 1
+	switch before {
+	case "", "+":
+	case "-":
+		a = -1
+	default:
+		var err error
+		if a, err = strconv.Atoi(before); err != nil {
+			return 0, 0, false
+		}
+	}
+	if after == "" {
+		return a, 0, true
+	} else if after[0] != '+' && after[0] != '-' {
+		return 0, 0, false
+	}
+	b, err := strconv.Atoi(after)
+	return a, b, err == nil
+}
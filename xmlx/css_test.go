@@ -0,0 +1,96 @@
+package xmlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const pageXml = `<html>
+	<body id="top">
+		<nav class="menu main">
+			<a id="home" href="/">Home</a>
+			<a id="docs" href="https://example.com/docs" lang="en-US">Docs</a>
+			<a id="blog" href="http://example.com/blog" class="external">Blog</a>
+		</nav>
+		<ul>
+			<li id="l1" class="item">one</li>
+			<li id="l2" class="item active">two</li>
+			<p id="p1"/>
+			<li id="l3" class="item">three</li>
+			<li id="l4" class="item"><span id="s1"/></li>
+		</ul>
+		<P id="p2"></P>
+	</body>
+</html>`
+
+func TestSelector(t *testing.T) {
+	doc, err := Parse(strings.NewReader(pageXml))
+	assert.Equal(t, nil, err)
+	cases := map[string][]string{
+		"a":                             {"home", "docs", "blog"},
+		"#docs":                         {"docs"},
+		".menu.main > a.external":       {"blog"},
+		"nav a[href^=http]":             {"docs", "blog"},
+		"a[href$='/blog'], #home":       {"home", "blog"},
+		"a[href*=example][lang|=en]":    {"docs"},
+		"[class~=active]":               {"l2"},
+		"a[ID=DOCS i]":                  {},
+		"a[id=DOCS i]":                  {"docs"},
+		"body > ul > li":                {"l1", "l2", "l3", "l4"},
+		"li + p":                        {"p1"},
+		"p ~ li":                        {"l3", "l4"},
+		"li:nth-child(2n+1)":            {"l1", "l4"},
+		"li:nth-child(odd)":             {"l1", "l4"},
+		"li:nth-of-type(odd)":           {"l1", "l3"},
+		"li:nth-child(-n+2)":            {"l1", "l2"},
+		"li:nth-last-child(1)":          {"l4"},
+		"ul > :first-of-type":           {"l1", "p1"},
+		"ul > :last-of-type":            {"p1", "l4"},
+		"li:first-child, li:last-child": {"l1", "l4"},
+		"li:not(.active, #l4)":          {"l1", "l3"},
+		"ul :not(li)":                   {"p1", "s1"},
+		"p":                             {"p1", "p2"},
+		"span:only-child":               {"s1"},
+		"ul *:empty":                    {"p1", "s1"},
+		":root":                         {""},
+		"html body nav ~ ul li:nth-child(5) span": {"s1"},
+	}
+	for text, expect := range cases {
+		ids := []string{}
+		for _, node := range doc.QueryAll(text) {
+			ids = append(ids, node.AttrString("id"))
+		}
+		assert.Equal(t, expect, ids, text)
+	}
+	assert.Equal(t, "Blog", doc.Query("nav > a:last-child").InnerText())
+	assert.Nil(t, doc.Query("table"))
+
+	sel, err := NewSelector("li.item")
+	assert.Equal(t, nil, err)
+	assert.True(t, sel.Match(doc.Query("#l3")))
+	assert.False(t, sel.Match(doc.Query("#p1")))
+	cached, _ := compileSelector("li.active")
+	again, _ := compileSelector("li.active")
+	assert.Same(t, cached, again)
+}
+
+func TestSelector_SyntaxError(t *testing.T) {
+	cases := map[string]int{
+		"a >":             3,
+		"a[href":          6,
+		"a[href=='x']":    7,
+		"li:nth-child(x)": 13,
+		"li:hover":        3,
+		"p::before":       2,
+		"a, ":             3,
+		"a[href='x]":      7,
+		"div )":           4,
+	}
+	for text, pos := range cases {
+		_, err := NewSelector(text)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, pos, err.(*SelectorError).Pos, text)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package xmlx
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// xpathFunc is a function of the XPath core library taking from min to max
+// arguments, max is -1 if unbounded. The first argument is a node-set if
+// nodeSet is set.
+type xpathFunc struct {
+	min     int
+	max     int
+	nodeSet bool
+	call    func(ctx *xpathContext, args []any) any
+}
+
+var xpathFunctions = map[string]*xpathFunc{
+	"last":             {0, 0, false, fnLast},
+	"position":         {0, 0, false, fnPosition},
+	"count":            {1, 1, true, fnCount},
+	"id":               {1, 1, false, fnId},
+	"local-name":       {0, 1, true, fnLocalName},
+	"namespace-uri":    {0, 1, true, fnNamespaceURI},
+	"name":             {0, 1, true, fnName},
+	"string":           {0, 1, false, fnString},
+	"concat":           {2, -1, false, fnConcat},
+	"starts-with":      {2, 2, false, fnStartsWith},
+	"contains":         {2, 2, false, fnContains},
+	"substring-before": {2, 2, false, fnSubstringBefore},
+	"substring-after":  {2, 2, false, fnSubstringAfter},
+	"substring":        {2, 3, false, fnSubstring},
+	"string-length":    {0, 1, false, fnStringLength},
+	"normalize-space":  {0, 1, false, fnNormalizeSpace},
+	"translate":        {3, 3, false, fnTranslate},
+	"boolean":          {1, 1, false, fnBoolean},
+	"not":              {1, 1, false, fnNot},
+	"true":             {0, 0, false, fnTrue},
+	"false":            {0, 0, false, fnFalse},
+	"lang":             {1, 1, false, fnLang},
+	"number":           {0, 1, false, fnNumber},
+	"sum":              {1, 1, true, fnSum},
+	"floor":            {1, 1, false, fnFloor},
+	"ceiling":          {1, 1, false, fnCeiling},
+	"round":            {1, 1, false, fnRound},
+}
+
+// stringValue is the XPath string-value of a node: the text it contains for
+// an element or a document, its value for anything else
+func stringValue(node *Node) string {
+	switch node.Type {
+	case ElementNode, DocumentNode:
+		buf := &strings.Builder{}
+		for _, p := range node.ChildNodes {
+			switch p.Type {
+			case ElementNode, TextNode, CDataSectionNode:
+				buf.WriteString(stringValue(p))
+			}
+		}
+		return buf.String()
+	}
+	return node.Value
+}
+
+func formatNumber(num float64) string {
+	switch {
+	case math.IsNaN(num):
+		return "NaN"
+	case math.IsInf(num, 1):
+		return "Infinity"
+	case math.IsInf(num, -1):
+		return "-Infinity"
+	case num == math.Trunc(num) && math.Abs(num) < 1e15:
+		return strconv.FormatInt(int64(num), 10)
+	}
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
+
+// xpathString converts a value the way string() does, a node-set gives the
+// string-value of its first node
+func xpathString(val any) string {
+	switch tmp := val.(type) {
+	case string:
+		return tmp
+	case float64:
+		return formatNumber(tmp)
+	case bool:
+		return strconv.FormatBool(tmp)
+	case []*Node:
+		if len(tmp) > 0 {
+			return stringValue(tmp[0])
+		}
+	}
+	return ""
+}
+
+func xpathNumber(val any) float64 {
+	switch tmp := val.(type) {
+	case float64:
+		return tmp
+	case bool:
+		if tmp {
+			return 1
+		}
+		return 0
+	case string, []*Node:
+		return parseNumber(xpathString(tmp))
+	}
+	return math.NaN()
+}
+
+// parseNumber reads an XPath number, which has no exponent, no sign but
+// '-' and no hexadecimal form
+func parseNumber(text string) float64 {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, "eExXpP_+iInN") {
+		return math.NaN()
+	}
+	num, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return num
+}
+
+func xpathBool(val any) bool {
+	switch tmp := val.(type) {
+	case bool:
+		return tmp
+	case float64:
+		return tmp != 0 && !math.IsNaN(tmp)
+	case string:
+		return tmp != ""
+	case []*Node:
+		return len(tmp) > 0
+	}
+	return false
+}
+
+// argOrSelf is the first argument, or the context node if there is none
+func argOrSelf(ctx *xpathContext, args []any) any {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return []*Node{ctx.node}
+}
+
+// nodeOrSelf is the first node of the optional node-set argument
+func nodeOrSelf(ctx *xpathContext, args []any) *Node {
+	if list := argOrSelf(ctx, args).([]*Node); len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+func fnLast(ctx *xpathContext, args []any) any {
+	return float64(ctx.size)
+}
+
+func fnPosition(ctx *xpathContext, args []any) any {
+	return float64(ctx.pos)
+}
+
+func fnCount(ctx *xpathContext, args []any) any {
+	return float64(len(args[0].([]*Node)))
+}
+
+// fnId selects the elements whose id attribute is one of the whitespace
+// separated ids, taken from the string-value of each node of a node-set
+func fnId(ctx *xpathContext, args []any) any {
+	var texts []string
+	if list, ok := args[0].([]*Node); ok {
+		for _, node := range list {
+			texts = append(texts, stringValue(node))
+		}
+	} else {
+		texts = append(texts, xpathString(args[0]))
+	}
+	want := map[string]bool{}
+	for _, text := range texts {
+		for _, id := range strings.Fields(text) {
+			want[id] = true
+		}
+	}
+	var list []*Node
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, p := range node.ChildNodes {
+			if p.Type == ElementNode {
+				if want[p.AttrString("id")] {
+					list = append(list, p)
+				}
+				walk(p)
+			}
+		}
+	}
+	walk(ctx.node.GetRoot())
+	return list
+}
+
+func fnLocalName(ctx *xpathContext, args []any) any {
+	node := nodeOrSelf(ctx, args)
+	if node != nil && node.Type == AttributeNode && isNamespaceDecl(node) {
+		return declaredPrefix(node)
+	} else if node != nil && node.Type != DocumentNode {
+		return node.Name
+	}
+	return ""
+}
+
+func fnNamespaceURI(ctx *xpathContext, args []any) any {
+	if node := nodeOrSelf(ctx, args); node != nil {
+		return node.NamespaceURI
+	}
+	return ""
+}
+
+func fnName(ctx *xpathContext, args []any) any {
+	if node := nodeOrSelf(ctx, args); node != nil && node.Type != DocumentNode {
+		return node.NameWithPrefix()
+	}
+	return ""
+}
+
+func fnString(ctx *xpathContext, args []any) any {
+	return xpathString(argOrSelf(ctx, args))
+}
+
+func fnConcat(ctx *xpathContext, args []any) any {
+	buf := &strings.Builder{}
+	for _, arg := range args {
+		buf.WriteString(xpathString(arg))
+	}
+	return buf.String()
+}
+
+func fnStartsWith(ctx *xpathContext, args []any) any {
+	return strings.HasPrefix(xpathString(args[0]), xpathString(args[1]))
+}
+
+func fnContains(ctx *xpathContext, args []any) any {
+	return strings.Contains(xpathString(args[0]), xpathString(args[1]))
+}
+
+func fnSubstringBefore(ctx *xpathContext, args []any) any {
+	before, _, ok := strings.Cut(xpathString(args[0]), xpathString(args[1]))
+	if !ok {
+		return ""
+	}
+	return before
+}
+
+func fnSubstringAfter(ctx *xpathContext, args []any) any {
+	_, after, _ := strings.Cut(xpathString(args[0]), xpathString(args[1]))
+	return after
+}
+
+// fnSubstring counts characters from 1 and rounds its arguments, so
+// substring('12345', 1.5, 2.6) is '234'
+func fnSubstring(ctx *xpathContext, args []any) any {
+	from := roundNumber(xpathNumber(args[1]))
+	to := math.Inf(1)
+	if len(args) > 2 {
+		to = from + roundNumber(xpathNumber(args[2]))
+	}
+	buf := &strings.Builder{}
+	for i, r := range []rune(xpathString(args[0])) {
+		if pos := float64(i + 1); pos >= from && pos < to {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func fnStringLength(ctx *xpathContext, args []any) any {
+	return float64(utf8.RuneCountInString(xpathString(argOrSelf(ctx, args))))
+}
+
+func fnNormalizeSpace(ctx *xpathContext, args []any) any {
+	return strings.Join(strings.FieldsFunc(xpathString(argOrSelf(ctx, args)), unicode.IsSpace), " ")
+}
+
+func fnTranslate(ctx *xpathContext, args []any) any {
+	from := []rune(xpathString(args[1]))
+	to := []rune(xpathString(args[2]))
+	return strings.Map(func(r rune) rune {
+		for i, p := range from {
+			if p == r {
+				if i < len(to) {
+					return to[i]
+				}
+				return -1
+			}
+		}
+		return r
+	}, xpathString(args[0]))
+}
+
+func fnBoolean(ctx *xpathContext, args []any) any {
+	return xpathBool(args[0])
+}
+
+func fnNot(ctx *xpathContext, args []any) any {
+	return !xpathBool(args[0])
+}
+
+func fnTrue(ctx *xpathContext, args []any) any {
+	return true
+}
+
+func fnFalse(ctx *xpathContext, args []any) any {
+	return false
+}
+
+// fnLang tells if the xml:lang in scope is the language or a sublanguage
+func fnLang(ctx *xpathContext, args []any) any {
+	want := strings.ToLower(xpathString(args[0]))
+	for p := ctx.node; p != nil; p = p.ParentNode {
+		for _, attr := range p.Attrs {
+			if attr.Name == "lang" && (attr.NamespaceURI == xmlNamespace || attr.Prefix == "xml") {
+				have := strings.ToLower(attr.Value)
+				return have == want || strings.HasPrefix(have, want+"-")
+			}
+		}
+	}
+	return false
+}
+
+func fnNumber(ctx *xpathContext, args []any) any {
+	return xpathNumber(argOrSelf(ctx, args))
+}
+
+func fnSum(ctx *xpathContext, args []any) any {
+	var ret float64
+	for _, node := range args[0].([]*Node) {
+		ret += parseNumber(stringValue(node))
+	}
+	return ret
+}
+
+func fnFloor(ctx *xpathContext, args []any) any {
+	return math.Floor(xpathNumber(args[0]))
+}
+
+func fnCeiling(ctx *xpathContext, args []any) any {
+	return math.Ceil(xpathNumber(args[0]))
+}
+
+func fnRound(ctx *xpathContext, args []any) any {
+	return roundNumber(xpathNumber(args[0]))
+}
+
+// roundNumber rounds half up, towards positive infinity
+func roundNumber(num float64) float64 {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return num
+	}
+	return math.Floor(num + 0.5)
+}
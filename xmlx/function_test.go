@@ -0,0 +1,65 @@
+package xmlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const shelfXml = `<shelf xmlns:x="urn:x">
+	<book id="b1" lang="en"><title>Go in Action</title><price>30</price><tag>go</tag><tag>web</tag></book>
+	<book id="b2"><title>  The   Go  Programming Language </title><price>45.5</price><tag>go</tag></book>
+	<book id="b3"><title>Learning XML</title><price>25</price></book>
+	<x:note>remember</x:note>
+</shelf>`
+
+func TestXpath_Functions(t *testing.T) {
+	doc, err := Parse(strings.NewReader(shelfXml))
+	assert.Equal(t, nil, err)
+	cases := map[string][]string{
+		"//book[position() = 2]":                                                  {"b2"},
+		"//book[last()]":                                                          {"b3"},
+		"//book[position() mod 2 = 1]":                                            {"b1", "b3"},
+		"//book[position() < last() and price > 26]":                              {"b1", "b2"},
+		"//book[count(tag) = 2]":                                                  {"b1"},
+		"//book[count(tag) = 0 or sum(price) > 40]":                               {"b2", "b3"},
+		"//book[contains(title, 'Go')]":                                           {"b1", "b2"},
+		"//book[starts-with(@id, 'b') and not(@lang)]":                            {"b2", "b3"},
+		"//book[normalize-space(title) = 'The Go Programming Language']":          {"b2"},
+		"//book[string-length(title) = 12]":                                       {"b1", "b3"},
+		"//book[substring(title, 1, 5) = 'Learn']":                                {"b3"},
+		"//book[substring-after(title, 'in ') = 'Action']":                        {"b1"},
+		"//book[substring-before(@id, '2') = 'b']":                                {"b2"},
+		"//book[concat(@id, '-', tag) = 'b1-go']":                                 {"b1"},
+		"//book[translate(@id, 'b', 'B') = 'B3']":                                 {"b3"},
+		"//book[floor(price) = 45 and ceiling(price) = 46 and round(price) = 46]": {"b2"},
+		"//book[number(price) div 5 = 6]":                                         {"b1"},
+		"//book[boolean(tag) = false()]":                                          {"b3"},
+		"//book[name() = 'book' and local-name(title) = 'title']":                 {"b1", "b2", "b3"},
+	}
+	for text, expect := range cases {
+		var ids []string
+		for _, node := range doc.Find(text) {
+			ids = append(ids, node.AttrString("id"))
+		}
+		assert.Equal(t, expect, ids, text)
+	}
+	node := doc.FindOne("//*[namespace-uri() = 'urn:x']")
+	if assert.NotNil(t, node) {
+		assert.Equal(t, "note", node.Name)
+	}
+	assert.Equal(t, "remember", doc.FindOne("//*[. = 'remember']").InnerText())
+}
+
+func TestXpath_Conversions(t *testing.T) {
+	assert.Equal(t, "3", xpathString(3.0))
+	assert.Equal(t, "0.5", xpathString(0.5))
+	assert.Equal(t, "NaN", xpathString(xpathNumber("1e3")))
+	assert.Equal(t, 12.0, xpathNumber(" 12 "))
+	assert.Equal(t, false, xpathBool(""))
+	assert.Equal(t, true, xpathBool("false"))
+	assert.Equal(t, "234", fnSubstring(nil, []any{"12345", 1.5, 2.6}))
+	assert.Equal(t, "12", fnSubstring(nil, []any{"12345", 0.0, 3.0}))
+	assert.Equal(t, "AAA", fnTranslate(nil, []any{"--aaa--", "abc-", "ABC"}))
+	assert.Equal(t, -1.0, roundNumber(-1.5))
+}
@@ -0,0 +1,232 @@
+package xmlx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind uint
+
+const (
+	tkEOF tokenKind = iota
+	tkNumber
+	tkLiteral
+	// a name test: a QName, '*' or 'prefix:*'
+	tkName
+	// a name followed by '('
+	tkFunc
+	// a name followed by '::'
+	tkAxis
+	// and, or, mod, div and '*' where the grammar wants an operator
+	tkOperatorName
+	tkOperator
+	tkPunct
+)
+
+type xToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var nodeTypes = map[string]bool{
+	"comment":                true,
+	"text":                   true,
+	"processing-instruction": true,
+	"node":                   true,
+}
+
+// XpathError is a syntax error of an expression, or an error raised while
+// evaluating it
+type XpathError struct {
+	Expr string
+	// Pos is the byte offset of the error in Expr, -1 if unknown
+	Pos int
+	Msg string
+}
+
+func (e *XpathError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("xmlx: %s in %q", e.Msg, e.Expr)
+	}
+	return fmt.Sprintf("xmlx: %s at position %d in %q", e.Msg, e.Pos, e.Expr)
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r)
+}
+
+type xpathLexer struct {
+	text   string
+	offset int
+	tokens []xToken
+}
+
+func (lx *xpathLexer) peekRune(offset int) rune {
+	if offset >= len(lx.text) {
+		return utf8.RuneError
+	}
+	r, _ := utf8.DecodeRuneInString(lx.text[offset:])
+	return r
+}
+
+func (lx *xpathLexer) skipSpace(offset int) int {
+	for offset < len(lx.text) && strings.IndexByte(" \t\r\n", lx.text[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func (lx *xpathLexer) scanName(offset int) int {
+	for offset < len(lx.text) {
+		r, size := utf8.DecodeRuneInString(lx.text[offset:])
+		if !isNameChar(r) {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+// operatorWanted tells if the next token is read as an operator, that is
+// when it follows an operand, as the rule of the XPath 1.0 section 3.7
+func (lx *xpathLexer) operatorWanted() bool {
+	if len(lx.tokens) == 0 {
+		return false
+	}
+	last := lx.tokens[len(lx.tokens)-1]
+	switch last.kind {
+	case tkOperator, tkOperatorName, tkAxis, tkFunc:
+		return false
+	case tkPunct:
+		switch last.text {
+		case "@", "(", "[", ",", "::":
+			return false
+		}
+	}
+	return true
+}
+
+func (lx *xpathLexer) push(kind tokenKind, start int, end int) {
+	lx.tokens = append(lx.tokens, xToken{kind: kind, text: lx.text[start:end], pos: start})
+	lx.offset = end
+}
+
+func (lx *xpathLexer) fail(pos int, format string, args ...any) error {
+	return &XpathError{Expr: lx.text, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func lexXpath(text string) ([]xToken, error) {
+	lx := &xpathLexer{text: text}
+	for {
+		start := lx.skipSpace(lx.offset)
+		lx.offset = start
+		if start >= len(text) {
+			lx.tokens = append(lx.tokens, xToken{kind: tkEOF, pos: start})
+			return lx.tokens, nil
+		}
+		ch := text[start]
+		switch {
+		case ch == '"' || ch == '\'':
+			end := strings.IndexByte(text[start+1:], ch)
+			if end < 0 {
+				return nil, lx.fail(start, "unterminated string literal")
+			}
+			lx.tokens = append(lx.tokens, xToken{kind: tkLiteral, text: text[start+1 : start+1+end], pos: start})
+			lx.offset = start + end + 2
+		case ch >= '0' && ch <= '9' || ch == '.' && start+1 < len(text) && text[start+1] >= '0' && text[start+1] <= '9':
+			end := start
+			for end < len(text) && (text[end] >= '0' && text[end] <= '9' || text[end] == '.') {
+				end++
+			}
+			if strings.Count(text[start:end], ".") > 1 {
+				return nil, lx.fail(start, "invalid number %s", text[start:end])
+			}
+			lx.push(tkNumber, start, end)
+		case ch == '.':
+			if strings.HasPrefix(text[start:], "..") {
+				lx.push(tkPunct, start, start+2)
+			} else {
+				lx.push(tkPunct, start, start+1)
+			}
+		case ch == '/':
+			if strings.HasPrefix(text[start:], "//") {
+				lx.push(tkOperator, start, start+2)
+			} else {
+				lx.push(tkOperator, start, start+1)
+			}
+		case ch == ':' && strings.HasPrefix(text[start:], "::"):
+			return nil, lx.fail(start, "unexpected ::")
+		case strings.IndexByte("()[]@,", ch) >= 0:
+			lx.push(tkPunct, start, start+1)
+		case ch == '*':
+			if lx.operatorWanted() {
+				lx.push(tkOperatorName, start, start+1)
+			} else {
+				lx.push(tkName, start, start+1)
+			}
+		case strings.IndexByte("|+-=", ch) >= 0:
+			lx.push(tkOperator, start, start+1)
+		case ch == '!' || ch == '<' || ch == '>':
+			if strings.HasPrefix(text[start+1:], "=") {
+				lx.push(tkOperator, start, start+2)
+			} else if ch == '!' {
+				return nil, lx.fail(start, "unexpected !")
+			} else {
+				lx.push(tkOperator, start, start+1)
+			}
+		case ch == '$':
+			return nil, lx.fail(start, "variables are not supported")
+		case isNameStart(lx.peekRune(start)):
+			if err := lx.lexName(start); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, lx.fail(start, "unexpected %q", lx.peekRune(start))
+		}
+	}
+}
+
+// lexName reads an operator name, a function or node type name followed by
+// '(', an axis name followed by '::' or a name test
+func (lx *xpathLexer) lexName(start int) error {
+	text := lx.text
+	end := lx.scanName(start)
+	if lx.operatorWanted() {
+		switch word := text[start:end]; word {
+		case "and", "or", "mod", "div":
+			lx.push(tkOperatorName, start, end)
+			return nil
+		default:
+			return lx.fail(start, "unexpected %s, want an operator", word)
+		}
+	}
+	if next := lx.skipSpace(end); strings.HasPrefix(text[next:], "::") {
+		lx.push(tkAxis, start, end)
+		lx.push(tkPunct, next, next+2)
+		return nil
+	}
+	// a QName or prefix:*
+	if end+1 < len(text) && text[end] == ':' && text[end+1] != ':' {
+		if text[end+1] == '*' {
+			lx.push(tkName, start, end+2)
+			return nil
+		} else if isNameStart(lx.peekRune(end + 1)) {
+			end = lx.scanName(end + 1)
+		} else {
+			return lx.fail(end, "invalid name %s", text[start:end+1])
+		}
+	}
+	if next := lx.skipSpace(end); next < len(text) && text[next] == '(' {
+		lx.push(tkFunc, start, end)
+		return nil
+	}
+	lx.push(tkName, start, end)
+	return nil
+}
@@ -0,0 +1,97 @@
+package xmlx
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const soapXml = `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns="urn:app">
+	<s:Header><auth xmlns="urn:auth" token="t1"/></s:Header>
+	<env:Body xmlns:env="http://schemas.xmlsoap.org/soap/envelope/">
+		<order id="7" xml:lang="en-GB"><item/><item/></order>
+		<s:Fault/>
+	</env:Body>
+</s:Envelope>`
+
+func TestXpathNS(t *testing.T) {
+	doc, err := Parse(strings.NewReader(soapXml))
+	assert.Equal(t, nil, err)
+	ns := map[string]string{
+		"soap": "http://schemas.xmlsoap.org/soap/envelope/",
+		"app":  "urn:app",
+		"a":    "urn:auth",
+	}
+	cases := map[string]int{
+		"/soap:Envelope/soap:Body":              1,
+		"//soap:Body/app:order/app:item":        2,
+		"//soap:*":                              4,
+		"//a:auth[@token = 't1']":               1,
+		"//order":                               0,
+		"//app:auth":                            0,
+		"//soap:Body/*[local-name() = 'Fault']": 1,
+		"//*[namespace-uri() = 'urn:auth']":     1,
+		"//app:order[lang('en')]":               1,
+		"//app:order[lang('fr')]":               0,
+	}
+	for text, count := range cases {
+		xpath, err := NewXpathNS(text, ns)
+		if assert.Equal(t, nil, err, text) {
+			assert.Equal(t, count, len(xpath.SelectAll(doc)), text)
+		}
+	}
+
+	// the default binding applies to elements, unprefixed attributes stay in
+	// no namespace and the xml prefix is always bound
+	deflt := map[string]string{"": "urn:app"}
+	cases = map[string]int{
+		"//order/item":             2,
+		"//order[@id = '7']":       1,
+		"//order/attribute::id":    1,
+		"//order/@xml:lang":        1,
+		"//@xml:lang[. = 'en-GB']": 1,
+		"//auth[@token]":           0,
+		"//*[@token = 't1']":       1,
+	}
+	for text, count := range cases {
+		xpath, err := NewXpathNS(text, deflt)
+		if assert.Equal(t, nil, err, text) {
+			assert.Equal(t, count, len(xpath.SelectAll(doc)), text)
+		}
+	}
+	xpath, err := NewXpathNS("//app:order[@id = '7']/@xml:lang", ns)
+	if assert.Equal(t, nil, err) {
+		assert.Equal(t, 1, len(xpath.SelectAll(doc)))
+	}
+
+	// without bindings the prefixes are matched as written
+	assert.Equal(t, 1, len(doc.Find("//s:Envelope/env:Body")))
+	assert.Equal(t, 0, len(doc.Find("//s:Body")))
+	assert.Equal(t, 2, len(doc.Find("//order/item")))
+
+	_, err = NewXpathNS("//soap:Body/x:y", ns)
+	if assert.NotEqual(t, nil, err) {
+		assert.Equal(t, 12, err.(*XpathError).Pos)
+	}
+
+	body := doc.FindOne("//env:Body")
+	names := map[string]string{}
+	for _, node := range body.Find("namespace::*") {
+		xpath, _ := NewXpath("local-name()")
+		prefix, _ := xpath.EvaluateString(node)
+		names[prefix] = node.Value
+	}
+	assert.Equal(t, map[string]string{
+		"":    "urn:app",
+		"s":   "http://schemas.xmlsoap.org/soap/envelope/",
+		"env": "http://schemas.xmlsoap.org/soap/envelope/",
+	}, names)
+	assert.Equal(t, 0, len(body.Find("@*")))
+}
+
+func TestParse_NamespacePrefixes(t *testing.T) {
+	text := `<a xmlns="u:d" xmlns:x="u:x" x:k="1" k="2" xml:lang="en"><x:b xmlns:y="u:y" y:c="3"></x:b></a>`
+	doc, err := Parse(strings.NewReader(text))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, text, doc.InnerXML())
+}
@@ -305,3 +305,23 @@ func (node *Node) FindOne(selector string) *Node {
 	}
 	return xpath.SelectFirst(node)
 }
+
+// Query is the first element under node the CSS selector matches
+func (node *Node) Query(selector string) *Node {
+	sel, err := compileSelector(selector)
+	if err != nil {
+		logx.Error(err.Error())
+		return nil
+	}
+	return sel.SelectFirst(node)
+}
+
+// QueryAll is the elements under node the CSS selector matches
+func (node *Node) QueryAll(selector string) []*Node {
+	sel, err := compileSelector(selector)
+	if err != nil {
+		logx.Error(err.Error())
+		return nil
+	}
+	return sel.SelectAll(node)
+}
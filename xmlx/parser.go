@@ -0,0 +1,388 @@
+package xmlx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the nodes of a parsed XPath expression
+type (
+	xExpr interface{}
+
+	binaryExpr struct {
+		op   string
+		x, y xExpr
+		pos  int
+	}
+
+	negExpr struct {
+		x xExpr
+	}
+
+	literalExpr struct {
+		value string
+	}
+
+	numberExpr struct {
+		value float64
+	}
+
+	callExpr struct {
+		name string
+		fn   *xpathFunc
+		args []xExpr
+		pos  int
+	}
+
+	// filterExpr is a primary expression with predicates, like (//a)[1]
+	filterExpr struct {
+		x     xExpr
+		preds []xExpr
+		pos   int
+	}
+
+	// pathExpr is a location path, relative to the result of filter if any,
+	// to the root if absolute, or else to the context node
+	pathExpr struct {
+		filter   xExpr
+		absolute bool
+		steps    []*xStep
+		pos      int
+	}
+
+	xStep struct {
+		axis  string
+		test  nodeTest
+		preds []xExpr
+	}
+
+	// nodeTest is a node type test like text() when kind is set, or a name
+	// test where an empty local name stands for '*'. A name test of an
+	// expression with namespace bindings matches by the namespace uri.
+	nodeTest struct {
+		kind   string
+		target string
+		prefix string
+		local  string
+		bound  bool
+		uri    string
+	}
+)
+
+var axisNames = map[string]bool{
+	"ancestor":           true,
+	"ancestor-or-self":   true,
+	"attribute":          true,
+	"child":              true,
+	"descendant":         true,
+	"descendant-or-self": true,
+	"following":          true,
+	"following-sibling":  true,
+	"namespace":          true,
+	"parent":             true,
+	"preceding":          true,
+	"preceding-sibling":  true,
+	"self":               true,
+}
+
+// the precedence of the binary operators, unions bind tightest
+var binaryPrec = map[string]int{
+	"or":  1,
+	"and": 2,
+	"=":   3,
+	"!=":  3,
+	"<":   4,
+	"<=":  4,
+	">":   4,
+	">=":  4,
+	"+":   5,
+	"-":   5,
+	"*":   6,
+	"div": 6,
+	"mod": 6,
+}
+
+type xpathParser struct {
+	text   string
+	tokens []xToken
+	index  int
+	ns     map[string]string
+}
+
+// parseXpath parses text, resolving the prefixes of the name tests with ns
+// unless it is nil
+func parseXpath(text string, ns map[string]string) (xExpr, error) {
+	tokens, err := lexXpath(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &xpathParser{text: text, tokens: tokens, ns: ns}
+	var expr xExpr
+	err = p.try(func() {
+		expr = p.parseExpr(1)
+		if tk := p.peek(); tk.kind != tkEOF {
+			p.fail(tk, "unexpected %s", tk.text)
+		}
+	})
+	return expr, err
+}
+
+// try runs fn, turning the panic of fail into an error
+func (p *xpathParser) try(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if xe, ok := r.(*XpathError); ok {
+				err = xe
+				return
+			}
+			panic(r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+func (p *xpathParser) fail(tk xToken, format string, args ...any) {
+	panic(&XpathError{Expr: p.text, Pos: tk.pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *xpathParser) peek() xToken {
+	return p.tokens[p.index]
+}
+
+func (p *xpathParser) next() xToken {
+	tk := p.tokens[p.index]
+	if tk.kind != tkEOF {
+		p.index++
+	}
+	return tk
+}
+
+func (p *xpathParser) is(kind tokenKind, text string) bool {
+	tk := p.peek()
+	return tk.kind == kind && tk.text == text
+}
+
+func (p *xpathParser) expect(kind tokenKind, text string) {
+	if tk := p.next(); tk.kind != kind || tk.text != text {
+		if tk.kind == tkEOF {
+			p.fail(tk, "unexpected end, want %s", text)
+		}
+		p.fail(tk, "unexpected %s, want %s", tk.text, text)
+	}
+}
+
+// parseExpr parses the binary operators of at least prec by precedence
+// climbing, all of them are left associative
+func (p *xpathParser) parseExpr(prec int) xExpr {
+	x := p.parseUnary()
+	for {
+		tk := p.peek()
+		if tk.kind != tkOperator && tk.kind != tkOperatorName {
+			return x
+		}
+		opPrec, ok := binaryPrec[tk.text]
+		if !ok || opPrec < prec {
+			return x
+		}
+		p.next()
+		x = &binaryExpr{op: tk.text, x: x, y: p.parseExpr(opPrec + 1), pos: tk.pos}
+	}
+}
+
+func (p *xpathParser) parseUnary() xExpr {
+	if p.is(tkOperator, "-") {
+		p.next()
+		return &negExpr{x: p.parseUnary()}
+	}
+	x := p.parsePath()
+	for p.is(tkOperator, "|") {
+		tk := p.next()
+		x = &binaryExpr{op: "|", x: x, y: p.parsePath(), pos: tk.pos}
+	}
+	return x
+}
+
+func (p *xpathParser) parsePath() xExpr {
+	tk := p.peek()
+	switch {
+	case tk.kind == tkNumber, tk.kind == tkLiteral, tk.kind == tkPunct && tk.text == "(",
+		tk.kind == tkFunc && !nodeTypes[tk.text]:
+		x := p.parseFilter()
+		if p.is(tkOperator, "/") || p.is(tkOperator, "//") {
+			path := &pathExpr{filter: x, pos: tk.pos}
+			p.parseSteps(path)
+			return path
+		}
+		return x
+	case tk.kind == tkOperator && (tk.text == "/" || tk.text == "//"):
+		path := &pathExpr{absolute: true}
+		if tk.text == "/" && !p.stepAhead(1) {
+			p.next()
+			return path
+		}
+		p.parseSteps(path)
+		return path
+	}
+	path := &pathExpr{}
+	path.steps = append(path.steps, p.parseStep())
+	p.parseSteps(path)
+	return path
+}
+
+// stepAhead tells if the token at offset starts a step
+func (p *xpathParser) stepAhead(offset int) bool {
+	tk := p.tokens[p.index+offset]
+	switch tk.kind {
+	case tkName, tkAxis:
+		return true
+	case tkFunc:
+		return nodeTypes[tk.text]
+	case tkPunct:
+		return tk.text == "." || tk.text == ".." || tk.text == "@"
+	}
+	return false
+}
+
+// parseSteps parses the steps following a '/' or a '//'
+func (p *xpathParser) parseSteps(path *pathExpr) {
+	for p.is(tkOperator, "/") || p.is(tkOperator, "//") {
+		if p.next().text == "//" {
+			path.steps = append(path.steps, &xStep{axis: "descendant-or-self", test: nodeTest{kind: "node"}})
+		}
+		path.steps = append(path.steps, p.parseStep())
+	}
+}
+
+func (p *xpathParser) parseStep() *xStep {
+	tk := p.next()
+	step := &xStep{axis: "child"}
+	switch {
+	case tk.kind == tkPunct && tk.text == ".":
+		return &xStep{axis: "self", test: nodeTest{kind: "node"}}
+	case tk.kind == tkPunct && tk.text == "..":
+		return &xStep{axis: "parent", test: nodeTest{kind: "node"}}
+	case tk.kind == tkPunct && tk.text == "@":
+		step.axis = "attribute"
+		tk = p.next()
+	case tk.kind == tkAxis:
+		if !axisNames[tk.text] {
+			p.fail(tk, "unknown axis %s", tk.text)
+		}
+		step.axis = tk.text
+		p.expect(tkPunct, "::")
+		tk = p.next()
+	}
+	step.test = p.parseNodeTest(tk, step.axis)
+	step.preds = p.parsePredicates()
+	return step
+}
+
+// parseNodeTest parses the node test of a step on axis, the default
+// namespace binding only applies to the name tests of elements
+func (p *xpathParser) parseNodeTest(tk xToken, axis string) nodeTest {
+	switch tk.kind {
+	case tkName:
+		test := nodeTest{local: tk.text}
+		if prefix, local, ok := strings.Cut(tk.text, ":"); ok {
+			test.prefix = prefix
+			test.local = local
+		}
+		if test.local == "*" {
+			test.local = ""
+		}
+		// a bare '*' matches any element, whatever its namespace
+		if p.ns != nil && tk.text != "*" {
+			uri, ok := p.ns[test.prefix]
+			if test.prefix == "xml" {
+				uri, ok = xmlNamespace, true
+			} else if test.prefix == "" && (axis == "attribute" || axis == "namespace") {
+				uri = ""
+			}
+			if !ok && test.prefix != "" {
+				p.fail(tk, "undeclared prefix %s", test.prefix)
+			}
+			test.bound = true
+			test.uri = uri
+		}
+		return test
+	case tkFunc:
+		if !nodeTypes[tk.text] {
+			p.fail(tk, "unexpected function %s in a location path", tk.text)
+		}
+		test := nodeTest{kind: tk.text}
+		p.expect(tkPunct, "(")
+		if tk.text == "processing-instruction" && p.peek().kind == tkLiteral {
+			test.target = p.next().text
+		}
+		p.expect(tkPunct, ")")
+		return test
+	case tkEOF:
+		p.fail(tk, "unexpected end, want a node test")
+	}
+	p.fail(tk, "unexpected %s, want a node test", tk.text)
+	return nodeTest{}
+}
+
+func (p *xpathParser) parsePredicates() []xExpr {
+	var preds []xExpr
+	for p.is(tkPunct, "[") {
+		p.next()
+		preds = append(preds, p.parseExpr(1))
+		p.expect(tkPunct, "]")
+	}
+	return preds
+}
+
+func (p *xpathParser) parseFilter() xExpr {
+	pos := p.peek().pos
+	x := p.parsePrimary()
+	if preds := p.parsePredicates(); len(preds) > 0 {
+		return &filterExpr{x: x, preds: preds, pos: pos}
+	}
+	return x
+}
+
+func (p *xpathParser) parsePrimary() xExpr {
+	tk := p.next()
+	switch tk.kind {
+	case tkNumber:
+		num, err := strconv.ParseFloat(tk.text, 64)
+		if err != nil {
+			p.fail(tk, "invalid number %s", tk.text)
+		}
+		return &numberExpr{value: num}
+	case tkLiteral:
+		return &literalExpr{value: tk.text}
+	case tkFunc:
+		return p.parseCall(tk)
+	}
+	// a '('
+	x := p.parseExpr(1)
+	p.expect(tkPunct, ")")
+	return x
+}
+
+func (p *xpathParser) parseCall(tk xToken) xExpr {
+	fn, ok := xpathFunctions[tk.text]
+	if !ok {
+		p.fail(tk, "unknown function %s", tk.text)
+	}
+	call := &callExpr{name: tk.text, fn: fn, pos: tk.pos}
+	p.expect(tkPunct, "(")
+	if !p.is(tkPunct, ")") {
+		for {
+			call.args = append(call.args, p.parseExpr(1))
+			if !p.is(tkPunct, ",") {
+				break
+			}
+			p.next()
+		}
+	}
+	p.expect(tkPunct, ")")
+	if len(call.args) < fn.min || fn.max >= 0 && len(call.args) > fn.max {
+		p.fail(tk, "wrong number of arguments to %s", tk.text)
+	}
+	return call
+}
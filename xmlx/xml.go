@@ -12,7 +12,6 @@ import (
 
 const cdataOpen = "<![CDATA["
 const xmlnsPrefix = "xmlns"
-const xpathAttr = "__Attr__"
 
 type xmlStack struct {
 	*Node
@@ -27,31 +26,33 @@ func (stack *xmlStack) pushNext(node *Node, attrs []xml.Attr) *xmlStack {
 		Node:   node,
 		prefix: map[string]string{},
 		ns:     map[string]string{},
+		prev:   stack,
 	}
-	node.Attrs = []*Node{}
-	for i, attr := range attrs {
-		attrNs := attr.Name.Space
-		// namespace with prefix
-		if attr.Name.Space == xmlnsPrefix ||
-			// default namespace
-			attr.Name.Space == "" && attr.Name.Local == xmlnsPrefix {
-			attrNs = ""
-			if attr.Name.Space != "" {
-				next.prefix[attr.Value] = attr.Name.Local
-			}
+	// the declarations come first, the prefixes of the element and its
+	// attributes may use them
+	for _, attr := range attrs {
+		if attr.Name.Space == xmlnsPrefix {
+			next.prefix[attr.Value] = attr.Name.Local
+			next.ns[attr.Name.Local] = attr.Value
+		} else if attr.Name.Space == "" && attr.Name.Local == xmlnsPrefix {
 			next.ns[attr.Name.Local] = attr.Value
 		}
-		var attrPrefix string
-		if stack != nil {
-			attrPrefix = stack.getPrefix(attrNs)
-		}
+	}
+	node.Prefix = next.getPrefix(node.NamespaceURI)
+	node.Attrs = []*Node{}
+	for i, attr := range attrs {
 		newAttr := &Node{
 			Type:         AttributeNode,
 			ParentNode:   node,
 			Name:         attr.Name.Local,
 			Value:        attr.Value,
-			NamespaceURI: attrNs,
-			Prefix:       attrPrefix,
+			NamespaceURI: attr.Name.Space,
+		}
+		if attr.Name.Space == xmlnsPrefix {
+			newAttr.NamespaceURI = ""
+			newAttr.Prefix = xmlnsPrefix
+		} else if attr.Name.Space != "" {
+			newAttr.Prefix = next.getPrefix(attr.Name.Space)
 		}
 		if i > 0 {
 			newAttr.PrevSibling = node.Attrs[i-1]
@@ -59,7 +60,6 @@ func (stack *xmlStack) pushNext(node *Node, attrs []xml.Attr) *xmlStack {
 		}
 		node.Attrs = append(node.Attrs, newAttr)
 	}
-	next.prev = stack
 	if stack != nil {
 		stack.next = next
 	}
@@ -76,6 +76,9 @@ func (stack *xmlStack) popLast() *xmlStack {
 }
 
 func (stack *xmlStack) getPrefix(ns string) string {
+	if ns == xmlNamespace {
+		return "xml"
+	}
 	for p := stack; p != nil; p = p.prev {
 		if prefix, ok := p.prefix[ns]; ok {
 			return prefix
@@ -199,7 +202,6 @@ func (parser *xmlParser) parse() (*Node, error) {
 				Type:         ElementNode,
 				Name:         el.Name.Local,
 				NamespaceURI: el.Name.Space,
-				Prefix:       parent.getPrefix(el.Name.Space),
 			}
 			current = current.pushNext(node, el.Attr)
 		case xml.EndElement:
@@ -1,162 +1,112 @@
 package xmlx
 
-import (
-	"strings"
-)
-
+// XNodeHandler is called with each node an XNode visits, returning false
+// stops the walk
+//
+// Deprecated: use Xpath.
 type XNodeHandler func(node *Node) bool
 
+// XNode walks a single axis of a node at a time, calling its handler with
+// the nodes of the axis that pass the node test sel, like "a", "*" or
+// "text()"
+//
+// Deprecated: use Xpath, which evaluates whole expressions.
 type XNode struct {
 	*Node
 	handleNode XNodeHandler
 }
 
+// Deprecated: use NewXpath.
 func NewXpathNode(node *Node) *XNode {
 	return &XNode{Node: node}
 }
 
-func chooseNode(node *Node, sel string) bool {
-	if strings.HasSuffix(sel, "()") {
-		switch sel {
-		case "node()":
-			return true
-		case "text()":
-			return node.Type == TextNode
-		}
-	}
-
-	if node.Type != ElementNode && node.Type != DocumentNode {
-		return false
-	}
-	if sel == "*" {
-		return true
-	}
-	return sel == node.Name
-}
-
 func (it *XNode) setCheckin(checker XNodeHandler) {
 	it.handleNode = checker
 }
 
-func (it *XNode) Ancestor(sel string) {
-	for p := it.ParentNode; p != nil; p = p.ParentNode {
-		if !chooseNode(p, sel) {
-			continue
+// xnodeTest parses sel as the node test of a step on axis
+func xnodeTest(sel string, axis string) (nodeTest, bool) {
+	tokens, err := lexXpath(sel)
+	if err != nil {
+		return nodeTest{}, false
+	}
+	p := &xpathParser{text: sel, tokens: tokens}
+	var test nodeTest
+	err = p.try(func() {
+		test = p.parseNodeTest(p.next(), axis)
+		if tk := p.peek(); tk.kind != tkEOF {
+			p.fail(tk, "unexpected %s", tk.text)
 		}
+	})
+	return test, err == nil
+}
+
+// visit hands the nodes of axis that pass sel to the handler, a sel that
+// isn't a node test matches nothing
+func (it *XNode) visit(axis string, sel string) {
+	test, ok := xnodeTest(sel, axis)
+	if !ok || it.handleNode == nil {
+		return
+	}
+	for _, p := range axisOf(axis, it.Node, test) {
 		if !it.handleNode(p) {
 			break
 		}
 	}
 }
 
+func (it *XNode) Ancestor(sel string) {
+	it.visit("ancestor", sel)
+}
+
 func (it *XNode) AncestorOrSelf(sel string) {
-	if !it.chooseSelf(sel) {
-		return
-	}
-	it.Ancestor(sel)
+	it.visit("ancestor-or-self", sel)
 }
 
 func (it *XNode) Attribute(sel string) {
-	for _, p := range it.Attrs {
-		if sel == p.Name && !it.handleNode(p) {
-			break
-		}
-	}
+	it.visit("attribute", sel)
 }
 
 func (it *XNode) Child(sel string) {
-	for _, p := range it.ChildNodes {
-		if chooseNode(p, sel) && !it.handleNode(p) {
-			break
-		}
-	}
-}
-
-func nodeTreeLoop(node *Node, sel string, handleNode XNodeHandler) {
-	for _, p := range node.ChildNodes {
-		if chooseNode(p, sel) && !handleNode(p) {
-			break
-		}
-		if len(p.ChildNodes) > 0 {
-			nodeTreeLoop(p, sel, handleNode)
-		}
-	}
+	it.visit("child", sel)
 }
 
 func (it *XNode) Descendant(sel string) {
-	nodeTreeLoop(it.Node, sel, it.handleNode)
+	it.visit("descendant", sel)
 }
 
 func (it *XNode) DescendantOrSelf(sel string) {
-	if !it.chooseSelf(sel) {
-		return
-	}
-	it.Descendant(sel)
+	it.visit("descendant-or-self", sel)
 }
 
 func (it *XNode) Following(sel string) {
-	for p := it.NextSibling; p != nil; p = p.NextSibling {
-		xnd := NewXpathNode(p)
-		next := true
-		xnd.setCheckin(func(node *Node) bool {
-			next = it.handleNode(node)
-			return next
-		})
-		xnd.DescendantOrSelf(sel)
-		if !next {
-			return
-		}
-	}
-	if it.ParentNode != nil {
-		xnd := NewXpathNode(it.ParentNode)
-		xnd.setCheckin(func(node *Node) bool {
-			return it.handleNode(node)
-		})
-		xnd.Following(sel)
-	}
+	it.visit("following", sel)
 }
 
+// Namespace visits the namespace declarations in scope whose prefix is sel
 func (it *XNode) Namespace(sel string) {
-	if it.NamespaceURI == sel {
-		it.handleNode(it.Node)
-	}
+	it.visit("namespace", sel)
 }
 
 func (it *XNode) Parent() {
-	if chooseNode(it.Node, "*") {
-		it.handleNode(it.ParentNode)
-	}
+	it.visit("parent", "node()")
 }
 
 func (it *XNode) Preceding(sel string) {
-	if !it.chooseSelf(sel) {
-		return
-	}
-	it.PrecedingSibling(sel)
+	it.visit("preceding", sel)
 }
 
 func (it *XNode) PrecedingSibling(sel string) {
-	for p := it.PrevSibling; p != nil; p = p.PrevSibling {
-		if !it.handleNode(p) {
-			break
-		}
-	}
+	it.visit("preceding-sibling", sel)
 }
 
 func (it *XNode) Self(sel string) {
-	it.chooseSelf(sel)
+	it.visit("self", sel)
 }
 
 func (it *XNode) Root() {
-	root := it.GetRoot()
-	if chooseNode(root, "*") {
-		it.handleNode(root)
-	}
-}
-
-func (it *XNode) chooseSelf(sel string) bool {
-	if chooseNode(it.Node, sel) && !it.handleNode(it.Node) {
-		return false
+	if it.handleNode != nil {
+		it.handleNode(it.GetRoot())
 	}
-	return true
 }
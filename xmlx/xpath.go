@@ -1,48 +1,136 @@
 package xmlx
 
 import (
-	"fmt"
-	"github.com/avicd/go-utilx/conv"
-	"github.com/avicd/go-utilx/evalx"
-	"github.com/avicd/go-utilx/refx"
-	"io"
-	"strings"
+	"github.com/avicd/go-utilx/logx"
+	"math"
+	"sort"
 )
 
 type Xpath struct {
-	stacks []*xStack
-	expr   string
+	root xExpr
+	expr string
 }
 
+// NewXpath parses an XPath 1.0 expression, a syntax error is an *XpathError
+// telling where it is. Its name tests match the prefixes as written in the
+// document and a name without prefix matches in any namespace.
 func NewXpath(text string) (*Xpath, error) {
-	stacks, err := parseXpath(text)
+	return newXpath(text, nil)
+}
+
+// NewXpathNS parses an expression whose name tests match by namespace, ns
+// binds the prefixes to namespace uris. A name without prefix matches the
+// nodes in no namespace, or in the one bound to "" if any.
+func NewXpathNS(text string, ns map[string]string) (*Xpath, error) {
+	if ns == nil {
+		ns = map[string]string{}
+	}
+	return newXpath(text, ns)
+}
+
+func newXpath(text string, ns map[string]string) (*Xpath, error) {
+	root, err := parseXpath(text, ns)
 	if err != nil {
 		return nil, err
 	}
-	return &Xpath{stacks: stacks, expr: text}, nil
+	return &Xpath{root: root, expr: text}, nil
 }
 
-func (it *Xpath) SelectFirst(node *Node) *Node {
-	for _, stack := range it.stacks {
-		list := stack.eval(node, SelectFirst)
-		if len(list) > 0 {
-			return list[0]
+// eval evaluates the expression with node as the context node
+func (it *Xpath) eval(node *Node) (ret any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if xe, ok := r.(*XpathError); ok {
+				err = xe
+				return
+			}
+			panic(r)
 		}
+	}()
+	ctx := &xpathContext{node: node, pos: 1, size: 1, order: docOrder{}, expr: it.expr}
+	return ctx.eval(it.root), nil
+}
+
+// Evaluate evaluates the expression with node as the context node, the
+// result is a node-set as []*Node, a string, a float64 or a bool
+func (it *Xpath) Evaluate(node *Node) (any, error) {
+	return it.eval(node)
+}
+
+// EvaluateString evaluates the expression and converts the result as the
+// string() function does
+func (it *Xpath) EvaluateString(node *Node) (string, error) {
+	val, err := it.eval(node)
+	if err != nil {
+		return "", err
+	}
+	return xpathString(val), nil
+}
+
+// EvaluateNumber evaluates the expression and converts the result as the
+// number() function does
+func (it *Xpath) EvaluateNumber(node *Node) (float64, error) {
+	val, err := it.eval(node)
+	if err != nil {
+		return math.NaN(), err
+	}
+	return xpathNumber(val), nil
+}
+
+// EvaluateBool evaluates the expression and converts the result as the
+// boolean() function does
+func (it *Xpath) EvaluateBool(node *Node) (bool, error) {
+	val, err := it.eval(node)
+	if err != nil {
+		return false, err
+	}
+	return xpathBool(val), nil
+}
+
+// SelectFirst is the first node in document order the expression selects,
+// nil if there is none or it fails, the error is logged
+func (it *Xpath) SelectFirst(node *Node) *Node {
+	if list := it.selectNodes(node, SelectFirst); len(list) > 0 {
+		return list[0]
 	}
 	return nil
 }
 
+// SelectAll is the node-set the expression selects in document order, nil
+// if it fails or gives another type, the error is logged
 func (it *Xpath) SelectAll(node *Node) []*Node {
-	var list []*Node
-	for _, stack := range it.stacks {
-		rslt := stack.eval(node, SelectAll)
-		if len(rslt) > 0 {
-			list = append(list, rslt...)
-		}
+	return it.selectNodes(node, SelectAll)
+}
+
+func (it *Xpath) selectNodes(node *Node, stype SelectType) []*Node {
+	list, err := it.trySelect(node, stype)
+	if err != nil {
+		logx.Error(err.Error())
+		return nil
 	}
 	return list
 }
 
+func (it *Xpath) trySelect(node *Node, stype SelectType) (list []*Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if xe, ok := r.(*XpathError); ok {
+				err = xe
+				return
+			}
+			panic(r)
+		}
+	}()
+	ctx := &xpathContext{node: node, pos: 1, size: 1, order: docOrder{}, expr: it.expr}
+	if path, ok := it.root.(*pathExpr); ok && stype == SelectFirst && len(path.steps) > 0 {
+		if first := ctx.firstOfPath(path); first != nil {
+			return []*Node{first}, nil
+		}
+		return nil, nil
+	}
+	return ctx.nodeSetOf(it.root, 0), nil
+}
+
 func (it *Xpath) SelectLast(node *Node) *Node {
 	list := it.SelectAll(node)
 	if len(list) > 0 {
@@ -51,196 +139,253 @@ func (it *Xpath) SelectLast(node *Node) *Node {
 	return nil
 }
 
-type xStack struct {
-	call   string
-	sel    string
-	axis   string
-	choose string
-	root   bool
-	next   *xStack
+func (ctx *xpathContext) eval(input xExpr) any {
+	switch expr := input.(type) {
+	case *numberExpr:
+		return expr.value
+	case *literalExpr:
+		return expr.value
+	case *negExpr:
+		return -xpathNumber(ctx.eval(expr.x))
+	case *binaryExpr:
+		return ctx.evalBinary(expr)
+	case *callExpr:
+		args := make([]any, len(expr.args))
+		for i, arg := range expr.args {
+			args[i] = ctx.eval(arg)
+		}
+		if expr.fn.nodeSet && len(args) > 0 {
+			if _, ok := args[0].([]*Node); !ok {
+				ctx.fail(expr.pos, expr.name+"() wants a node-set")
+			}
+		}
+		return expr.fn.call(ctx, args)
+	case *filterExpr:
+		list := ctx.nodeSetOf(expr.x, expr.pos)
+		for _, pred := range expr.preds {
+			list = ctx.filter(list, pred)
+		}
+		return list
+	case *pathExpr:
+		return ctx.evalPath(expr)
+	}
+	return nil
 }
 
-func (it *xStack) pushNext() *xStack {
-	next := &xStack{}
-	if it != nil {
-		it.next = next
+func (ctx *xpathContext) nodeSetOf(expr xExpr, pos int) []*Node {
+	list, ok := ctx.eval(expr).([]*Node)
+	if !ok {
+		ctx.fail(pos, "not a node-set")
 	}
-	return next
+	return list
 }
 
-func (it *xStack) evalStack(input *Node, handler XNodeHandler, pool *indexPool) {
-	xnd := NewXpathNode(input)
-	var list []*Node
-	xnd.setCheckin(func(node *Node) bool {
-		pool.cacheIndex(node)
-		list = append(list, node)
-		if it.choose == "" {
-			if it.next != nil {
-				it.next.evalStack(node, handler, pool)
-			} else {
-				return handler(node)
+func (ctx *xpathContext) evalBinary(expr *binaryExpr) any {
+	switch expr.op {
+	case "or":
+		return xpathBool(ctx.eval(expr.x)) || xpathBool(ctx.eval(expr.y))
+	case "and":
+		return xpathBool(ctx.eval(expr.x)) && xpathBool(ctx.eval(expr.y))
+	case "|":
+		x := ctx.nodeSetOf(expr.x, expr.pos)
+		y := ctx.nodeSetOf(expr.y, expr.pos)
+		return ctx.sortNodes(append(append([]*Node{}, x...), y...))
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compareValues(expr.op, ctx.eval(expr.x), ctx.eval(expr.y))
+	}
+	x := xpathNumber(ctx.eval(expr.x))
+	y := xpathNumber(ctx.eval(expr.y))
+	switch expr.op {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "div":
+		return x / y
+	}
+	return math.Mod(x, y)
+}
+
+// compareValues compares the way XPath does: a node-set matches if any of
+// its nodes does
+func compareValues(op string, x any, y any) bool {
+	xs, xSet := x.([]*Node)
+	ys, ySet := y.([]*Node)
+	switch {
+	case xSet && ySet:
+		for _, a := range xs {
+			for _, b := range ys {
+				if compareAtoms(op, stringValue(a), stringValue(b)) {
+					return true
+				}
 			}
 		}
-		return true
-	})
-	ctx := newEvalCtx(xnd)
-	ctx.bind("indexPool", pool)
-	evalx.Eval(it.axis, ctx)
-	if it.choose != "" && len(list) > 0 {
-		for _, p := range list {
-			pctx := newEvalCtx(NewXpathNode(p))
-			val, _ := evalx.Eval(it.choose, pctx)
-			var pass *Node
-			if refx.IsGeneralInt(val) {
-				if refx.AsInt64(val) == int64(pool.GetIndex(p)) {
-					pass = p
-				}
-			} else if refx.AsBool(val) {
-				pass = p
+		return false
+	case xSet:
+		if _, ok := y.(bool); ok {
+			return compareAtoms(op, len(xs) > 0, y)
+		}
+		for _, a := range xs {
+			if compareAtoms(op, atomOf(a, y), y) {
+				return true
 			}
-			if pass != nil {
-				if it.next != nil {
-					it.next.evalStack(pass, handler, pool)
-				} else {
-					handler(pass)
-				}
+		}
+		return false
+	case ySet:
+		if _, ok := x.(bool); ok {
+			return compareAtoms(op, x, len(ys) > 0)
+		}
+		for _, b := range ys {
+			if compareAtoms(op, x, atomOf(b, x)) {
+				return true
 			}
 		}
+		return false
+	}
+	return compareAtoms(op, x, y)
+}
+
+// atomOf is the value of a node to compare with other, a number if other
+// is one
+func atomOf(node *Node, other any) any {
+	if _, ok := other.(float64); ok {
+		return parseNumber(stringValue(node))
 	}
+	return stringValue(node)
 }
 
-func (it *xStack) eval(input *Node, stype SelectType) []*Node {
+func compareAtoms(op string, x any, y any) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, xBool := x.(bool)
+		_, yBool := y.(bool)
+		_, xNum := x.(float64)
+		_, yNum := y.(float64)
+		switch {
+		case xBool || yBool:
+			eq = xpathBool(x) == xpathBool(y)
+		case xNum || yNum:
+			eq = xpathNumber(x) == xpathNumber(y)
+		default:
+			eq = xpathString(x) == xpathString(y)
+		}
+		return eq == (op == "=")
+	}
+	a, b := xpathNumber(x), xpathNumber(y)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+func (ctx *xpathContext) evalPath(expr *pathExpr) []*Node {
 	var list []*Node
-	pool := &indexPool{cache: map[*Node]map[*Node]int{}}
-	var handler XNodeHandler
-	rc := map[*Node]bool{}
-	handler = func(node *Node) bool {
-		if _, ok := rc[node]; !ok {
-			rc[node] = true
-			list = append(list, node)
-			if stype == SelectFirst {
-				return false
+	switch {
+	case expr.filter != nil:
+		list = ctx.nodeSetOf(expr.filter, expr.pos)
+	case expr.absolute:
+		list = []*Node{ctx.node.GetRoot()}
+	default:
+		list = []*Node{ctx.node}
+	}
+	for _, step := range expr.steps {
+		list = ctx.evalStep(step, list)
+	}
+	return list
+}
+
+// evalStep selects the nodes of step from each of the input nodes
+func (ctx *xpathContext) evalStep(step *xStep, input []*Node) []*Node {
+	var ret []*Node
+	seen := map[*Node]bool{}
+	for _, node := range input {
+		list := axisOf(step.axis, node, step.test)
+		for _, pred := range step.preds {
+			list = ctx.filter(list, pred)
+		}
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				ret = append(ret, p)
 			}
 		}
-		return true
 	}
-	it.evalStack(input, handler, pool)
-	return list
+	return ctx.sortNodes(ret)
+}
+
+// subtreeAxes are the axes selecting nothing before their context node in
+// document order
+var subtreeAxes = map[string]bool{
+	"attribute":          true,
+	"child":              true,
+	"descendant":         true,
+	"descendant-or-self": true,
+	"self":               true,
 }
 
-func parseXpath(text string) ([]*xStack, error) {
-	r := strings.NewReader(strings.TrimSpace(text))
-	var pre byte
-	var stacks []*xStack
-	var root *xStack
-	var current *xStack
-	buf := &strings.Builder{}
-	index := -1
-	var sl byte
-	var cl bool
-	split := func() {
-		if current != nil && buf.Len() > 0 {
-			current.sel = buf.String()
-			buf.Reset()
-		}
-	}
-	collect := func() {
-		split()
-		stacks = append(stacks, root)
-		root = nil
-		current = nil
-		index = -1
-	}
-	for {
-		ch, err := r.ReadByte()
-		if err == io.EOF {
-			collect()
+// firstOfPath is the first node of a path in document order. The steps but
+// the last are evaluated in full, the last one stops at the first input
+// node coming after the best match when its axis stays in the subtree.
+func (ctx *xpathContext) firstOfPath(expr *pathExpr) *Node {
+	last := expr.steps[len(expr.steps)-1]
+	input := ctx.evalPath(&pathExpr{
+		filter:   expr.filter,
+		absolute: expr.absolute,
+		steps:    expr.steps[:len(expr.steps)-1],
+		pos:      expr.pos,
+	})
+	var best *Node
+	for _, node := range input {
+		if best != nil && subtreeAxes[last.axis] && ctx.order.indexOf(node) > ctx.order.indexOf(best) {
 			break
 		}
-		index++
-		if (sl == 0) || ch == sl {
-			switch ch {
-			case '/':
-				if pre == '/' {
-					current.call = "DescendantOrSelf"
-				} else {
-					split()
-					current = current.pushNext()
-					current.call = "Child"
-					current.root = index == 0
-				}
-			case '[':
-				current.sel = buf.String()
-				buf.Reset()
-				cl = true
-			case ']':
-				current.choose = buf.String()
-				buf.Reset()
-				cl = false
-			case '\'', '"':
-				if sl == 0 {
-					sl = ch
-				} else {
-					sl = 0
-				}
-				buf.WriteByte('"')
-			case ':':
-				if pre == ':' {
-					current.call = conv.BigCamelCase(buf.String())
-					buf.Reset()
-				}
-			case '.':
-				if pre == '.' {
-					current.call = "Parent"
-				}
-			case '@':
-				if !cl {
-					if current == nil {
-						current = current.pushNext()
-					}
-					current.call = "Attribute"
-				} else {
-					buf.WriteString(xpathAttr)
-				}
-			case '=':
-				if !(pre == '!' || pre == '>' || pre == '<') {
-					buf.WriteString("==")
-				} else {
-					buf.WriteByte('=')
-				}
-			case '|':
-				collect()
-			default:
-				if current == nil {
-					current = current.pushNext()
-					current.call = "Child"
-				}
-				buf.WriteByte(ch)
+		list := axisOf(last.axis, node, last.test)
+		for _, pred := range last.preds {
+			list = ctx.filter(list, pred)
+		}
+		for _, p := range list {
+			if best == nil || ctx.order.indexOf(p) < ctx.order.indexOf(best) {
+				best = p
 			}
-		} else {
-			buf.WriteByte(ch)
 		}
+	}
+	return best
+}
 
-		if current != nil && root == nil {
-			root = current
+// filter keeps the nodes of list the predicate holds for, where a number
+// stands for position() = number
+func (ctx *xpathContext) filter(list []*Node, pred xExpr) []*Node {
+	var ret []*Node
+	for i, node := range list {
+		val := ctx.at(node, i+1, len(list)).eval(pred)
+		if num, ok := val.(float64); ok {
+			if num == float64(i+1) {
+				ret = append(ret, node)
+			}
+		} else if xpathBool(val) {
+			ret = append(ret, node)
 		}
-		pre = ch
 	}
-	for hi, hd := range stacks {
-		if hd.root {
-			stacks[hi] = &xStack{next: hd, call: "self.Root"}
-		} else {
-			hd.call = "self." + hd.call
-		}
-		for p := stacks[hi]; p != nil; p = p.next {
-			var axis string
-			if p.sel != "" {
-				axis = fmt.Sprintf("%s(\"%s\")", p.call, p.sel)
-			} else {
-				axis = p.call + "()"
-			}
-			p.axis = axis
+	return ret
+}
+
+// sortNodes sorts a node-set in document order and drops the duplicates
+func (ctx *xpathContext) sortNodes(list []*Node) []*Node {
+	sort.SliceStable(list, func(i, j int) bool {
+		return ctx.order.indexOf(list[i]) < ctx.order.indexOf(list[j])
+	})
+	var ret []*Node
+	for i, node := range list {
+		if i == 0 || node != list[i-1] {
+			ret = append(ret, node)
 		}
 	}
-	return stacks, nil
+	return ret
 }
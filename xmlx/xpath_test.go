@@ -1,6 +1,8 @@
 package xmlx
 
 import (
+	"github.com/stretchr/testify/assert"
+	"math"
 	"strings"
 	"testing"
 )
@@ -48,3 +50,198 @@ func TestCompile(t *testing.T) {
 	s.Remove()
 	println(s)
 }
+
+const catalogXml = `<catalog>
+	<a id="1" x="1" y="2"><b><c/></b></a>
+	<a id="2" x="1" y="3"><b/></a>
+	<!-- note -->
+	<a id="3" x="2" y="2"><b><c/></b><d>tail</d></a>
+	<e id="4"/>
+</catalog>`
+
+func ids(list []*Node) []string {
+	var ret []string
+	for _, node := range list {
+		if node.Type == AttributeNode {
+			ret = append(ret, node.ParentNode.AttrString("id")+"@"+node.Name)
+		} else {
+			ret = append(ret, node.Name+node.AttrString("id"))
+		}
+	}
+	return ret
+}
+
+func TestXpath_Parse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(catalogXml))
+	assert.Equal(t, nil, err)
+	cases := map[string][]string{
+		"/catalog/a":                        {"a1", "a2", "a3"},
+		"//a[b[c]]":                         {"a1", "a3"},
+		"//a[@x='1' and @y='2']":            {"a1"},
+		"//a[@x = 1 or @y = 3]":             {"a1", "a2"},
+		"//a[1]":                            {"a1"},
+		"(//a)[last()]":                     {"a3"},
+		"(//a | //e)[position() > 2]":       {"a3", "e4"},
+		"(//a)[2]/b":                        {"b"},
+		"//e | //a[1]":                      {"a1", "e4"},
+		"//a[@id mod 2 = 1][@id div 3 = 1]": {"a3"},
+		"//a[-@id < -1.5]":                  {"a2", "a3"},
+		"//a[count(b/c | d) = 2]":           {"a3"},
+		"//c/ancestor::a":                   {"a1", "a3"},
+		"//c/ancestor-or-self::*[@id]":      {"a1", "a3"},
+		"//c/../..":                         {"a1", "a3"},
+		"//a[2]/following-sibling::*":       {"a3", "e4"},
+		"//a[2]/preceding-sibling::a":       {"a1"},
+		"//a[3]/preceding-sibling::*[1]":    {"a2"},
+		"//a[2]/following::*[1]":            {"a3"},
+		"//a[2]/b/preceding::*":             {"a1", "b", "c"},
+		"//a[2]/@*":                         {"2@id", "2@x", "2@y"},
+		"//a[@y = 2]/attribute::y":          {"1@y", "3@y"},
+		"//d/self::node()/parent::*":        {"a3"},
+		"//a[3]/descendant::*":              {"b", "c", "d"},
+		"//a[3]/descendant ::c":             {"c"},
+		"//d/parent :: a":                   {"a3"},
+		"/descendant::a[.//c][not(@x = 1)]": {"a3"},
+		"//a[d = 'tail']":                   {"a3"},
+		"//a[b and not(b/c)]":               {"a2"},
+		"id('2 4')":                         {"a2", "e4"},
+		"//*[@id = //a[@x = 2]/@y]":         {"a2"},
+	}
+	for text, expect := range cases {
+		assert.Equal(t, expect, ids(doc.Find(text)), text)
+		assert.Equal(t, expect[:1], ids([]*Node{doc.FindOne(text)}), text)
+		// the first match from every node in document order
+		for _, node := range doc.Find("//node() | //@*") {
+			xpath, _ := NewXpath(text)
+			var want []string
+			if list := xpath.SelectAll(node); len(list) > 0 {
+				want = ids(list[:1])
+			}
+			var got []string
+			if first := xpath.SelectFirst(node); first != nil {
+				got = ids([]*Node{first})
+			}
+			assert.Equal(t, want, got, text)
+		}
+	}
+	assert.Equal(t, 1, len(doc.Find("//comment()")))
+	assert.Equal(t, "tail", doc.FindOne("//d/text()").Value)
+	assert.Equal(t, doc, doc.FindOne("/"))
+
+	// a failing expression gives nil rather than a partial result
+	xpath, _ := NewXpath("count(//a)")
+	assert.Nil(t, xpath.SelectAll(doc))
+	assert.Nil(t, xpath.SelectFirst(doc))
+	_, err = xpath.trySelect(doc, SelectAll)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestXpath_SyntaxError(t *testing.T) {
+	cases := map[string]int{
+		"//a[":        4,
+		"//a[@x=]":    7,
+		"//a]":        3,
+		"//a[@x='1]":  7,
+		"count(":      6,
+		"unknown(1)":  0,
+		"count(1, 2)": 0,
+		"bogus::a":    0,
+		"child::":     7,
+		"1 +":         3,
+		"//a[1] b":    7,
+		"//a[$v]":     4,
+		"a!b":         1,
+		"/a/@":        4,
+	}
+	for text, pos := range cases {
+		_, err := NewXpath(text)
+		if assert.NotEqual(t, nil, err, text) {
+			assert.Equal(t, pos, err.(*XpathError).Pos, text)
+		}
+	}
+}
+
+func TestXpath_Evaluate(t *testing.T) {
+	doc, err := Parse(strings.NewReader(shelfXml))
+	assert.Equal(t, nil, err)
+	cases := map[string]any{
+		"count(//book)":                       3.0,
+		"sum(//price)":                        100.5,
+		"sum(//price) div count(//price)":     33.5,
+		"string(//book/title)":                "Go in Action",
+		"//book[2]/@id = 'b2'":                true,
+		"concat(//book[3]/@id, ':', 1 + 2)":   "b3:3",
+		"count(//tag) > 2 and count(//x) = 0": true,
+		"1 div 0":                             math.Inf(1),
+		"-(1 div 0)":                          math.Inf(-1),
+		"7 mod -3":                            1.0,
+		"'abc'":                               "abc",
+	}
+	for text, expect := range cases {
+		xpath, err := NewXpath(text)
+		if !assert.Equal(t, nil, err, text) {
+			continue
+		}
+		ret, err := xpath.Evaluate(doc)
+		assert.Equal(t, nil, err, text)
+		assert.Equal(t, expect, ret, text)
+	}
+
+	xpath, _ := NewXpath("//book[price > 26]")
+	ret, _ := xpath.Evaluate(doc)
+	assert.Equal(t, 2, len(ret.([]*Node)))
+	text, _ := xpath.EvaluateString(doc)
+	assert.Equal(t, "Go in Action30goweb", text)
+	ok, _ := xpath.EvaluateBool(doc)
+	assert.Equal(t, true, ok)
+	num, _ := xpath.EvaluateNumber(doc)
+	assert.True(t, math.IsNaN(num))
+
+	xpath, _ = NewXpath("//book[1]/price * 2")
+	num, _ = xpath.EvaluateNumber(doc)
+	assert.Equal(t, 60.0, num)
+	text, _ = xpath.EvaluateString(doc)
+	assert.Equal(t, "60", text)
+
+	xpath, _ = NewXpath("count('a')")
+	_, err = xpath.Evaluate(doc)
+	if assert.NotEqual(t, nil, err) {
+		assert.Equal(t, 0, err.(*XpathError).Pos)
+	}
+	xpath, _ = NewXpath("('a')[1]")
+	_, err = xpath.EvaluateString(doc)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestXNode(t *testing.T) {
+	doc, err := Parse(strings.NewReader(catalogXml))
+	assert.Equal(t, nil, err)
+	visit := func(node *Node, walk func(xnd *XNode)) []string {
+		var list []*Node
+		xnd := NewXpathNode(node)
+		xnd.setCheckin(func(node *Node) bool {
+			list = append(list, node)
+			return true
+		})
+		walk(xnd)
+		return ids(list)
+	}
+	a3 := doc.FindOne("//a[3]")
+	c := doc.FindOne("//a[3]//c")
+	assert.Equal(t, []string{"a1", "a2", "a3"}, visit(doc.FindOne("/catalog"), func(xnd *XNode) { xnd.Child("a") }))
+	assert.Equal(t, []string{"b", "c", "d"}, visit(a3, func(xnd *XNode) { xnd.Descendant("*") }))
+	assert.Equal(t, []string{"3@id", "3@x", "3@y"}, visit(a3, func(xnd *XNode) { xnd.Attribute("*") }))
+	assert.Equal(t, []string{"b", "a3"}, visit(c, func(xnd *XNode) { xnd.Ancestor("b"); xnd.Ancestor("a") }))
+	assert.Equal(t, []string{"a2", "a1"}, visit(a3, func(xnd *XNode) { xnd.PrecedingSibling("a") }))
+	assert.Equal(t, []string{"a3"}, visit(a3, func(xnd *XNode) { xnd.Self("a"); xnd.Self("b"); xnd.Self("[") }))
+	assert.Equal(t, []string{"catalog"}, visit(a3, func(xnd *XNode) { xnd.Parent() }))
+
+	var first []*Node
+	xnd := NewXpathNode(doc.FindOne("/catalog"))
+	xnd.setCheckin(func(node *Node) bool {
+		first = append(first, node)
+		return false
+	})
+	xnd.Descendant("a")
+	assert.Equal(t, []string{"a1"}, ids(first))
+}